@@ -2,27 +2,47 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/SimonStiil/keyvaluedatabase/rest"
 )
 
 type Application struct {
-	Config       ConfigType
-	KVDBClient   *Client
-	Logger       *slog.Logger
-	Requestcount int
+	Config         ConfigType
+	KVDBClient     *Client
+	Templates      *Templates
+	Assets         *Assets
+	Auditor        *Auditor
+	Rotator        *Rotator
+	Webhooks       *Webhooks
+	Metadata       *MetadataStore
+	Expiry         *ExpiryIndex
+	Imports        *ImportStore
+	Sessions       *SessionStore
+	OIDC           *OIDCClient
+	Generators     *Generators
+	Local          *LocalAuth
+	FingerprintKey []byte
+	Logger         *slog.Logger
+	Requestcount   int
 }
 type KeyValueList struct {
-	Api       string
-	Namespace string
-	System    bool
-	Items     []KeyValue
+	Page
+	Namespace  string
+	System     bool
+	Items      []KeyValue
+	Error      string
+	Generators []string
+	Generator  string
+	Tags       []string
+	Tag        string
 }
 type KeyValue struct {
 	Id       int
@@ -30,10 +50,15 @@ type KeyValue struct {
 	Value    string
 	Lines    int
 	ReadOnly bool
+	NoDelete bool
+	Format   string
+	Binary   string
+	Metadata KeyMetadata
+	Expiry   string
 }
 
 type NamespaceKeyValueList struct {
-	Api   string
+	Page
 	Items []NamespaceKeyValue
 }
 type NamespaceKeyValue struct {
@@ -41,6 +66,7 @@ type NamespaceKeyValue struct {
 	Name   string
 	Size   int
 	Access bool
+	Role   Role
 }
 
 func (App *Application) HealthActuator(w http.ResponseWriter, r *http.Request) {
@@ -97,10 +123,87 @@ func (App *Application) RootController(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/v1", http.StatusSeeOther)
 		return
 	}
+	request.Identity = App.identify(r)
+	request.CSRFToken = App.csrfToken(w, r)
+	if request.Api == "auth" {
+		App.AuthController(w, request)
+		return
+	}
+	if !App.requireLogin(w, request) {
+		return
+	}
+	if App.rejectReadOnly(logger, w, request) {
+		return
+	}
+	if request.Api == "audit" && request.Namespace == "" {
+		if App.authorizeGlobal(logger, w, request, "ViewAudit") {
+			App.AuditController(w, request)
+		}
+		return
+	}
+	if request.Api == "rotation" && request.Namespace == "" {
+		if App.authorizeGlobal(logger, w, request, "ViewRotation") {
+			App.RotationController(w, request)
+		}
+		return
+	}
+	if request.Api == "webhooks" && request.Namespace == "" {
+		if App.authorizeGlobal(logger, w, request, "ViewWebhooks") {
+			App.WebhooksController(w, request)
+		}
+		return
+	}
+	if request.Api == "trash" && request.Namespace == "" {
+		App.TrashController(w, request)
+		return
+	}
+	if request.Api == "expiring" && request.Namespace == "" {
+		App.ExpiringController(w, request)
+		return
+	}
 	if request.Api == "v1" {
 		if request.Namespace != "" {
-			App.KeysController(w, request)
-			return
+			if !App.authorize(logger, w, request, request.Namespace, RoleViewer, "View") {
+				return
+			}
+			switch request.Action {
+			case "":
+				App.KeysController(w, request)
+				return
+			case "delete":
+				App.NamespaceDeleteController(w, request)
+				return
+			case "clone":
+				App.NamespaceCloneController(w, request)
+				return
+			case "export":
+				App.NamespaceExportController(w, request)
+				return
+			case "import":
+				App.NamespaceImportController(w, request)
+				return
+			case "compare":
+				App.NamespaceCompareController(w, request)
+				return
+			case "edit":
+				App.KeyEditController(w, request)
+				return
+			case "upload":
+				App.KeyUploadController(w, request)
+				return
+			case "download":
+				App.KeyDownloadController(w, request)
+				return
+			case "report":
+				App.NamespaceReportController(w, request)
+				return
+			case "bulk":
+				App.KeyBulkController(w, request)
+				return
+			case "metadata":
+				App.KeyMetadataController(w, request)
+				return
+			}
 		} else {
 			App.NamespaceController(w, request)
 			return
@@ -125,14 +228,24 @@ func (App *Application) NamespaceController(w http.ResponseWriter, request *Requ
 			App.BadRequestHandler(logger, w, request)
 			return
 		} else {
-			debugLogger.Debug("ParseForm", "values", request.orgRequest.PostForm)
+			debugLogger.Debug("ParseForm", "fields", slices.Collect(maps.Keys(request.orgRequest.PostForm)))
+		}
+		err = App.verifyCSRF(request)
+		if err != nil {
+			debugLogger.Debug("CSRF Error", "type", fmt.Sprintf("%t", err), "error", err)
+			App.ForbiddenHandler(logger, w, request)
+			return
 		}
 		function := request.orgRequest.PostFormValue("input")
 		requests.WithLabelValues(request.Path, request.Method, function).Inc()
 		namespaceName := request.orgRequest.PostFormValue("name")
 		switch function {
 		case "Create":
+			if !App.authorize(logger, w, request, namespaceName, RoleAdmin, "CreateNamespace") {
+				return
+			}
 			err = App.KVDBClient.CreateNamespace(logger, namespaceName)
+			App.audit(request, "CreateNamespace", namespaceName, "", err)
 		default:
 			debugLogger.Debug("Unknown post", "function", function)
 		}
@@ -152,11 +265,9 @@ func (App *Application) NamespaceController(w http.ResponseWriter, request *Requ
 		App.BadRequestHandler(logger, w, request)
 		return
 	}
-	KeyValueList := App.convertNamespaceList(request.Api, kvlist)
-	w.WriteHeader(statuscode)
-	// https://pkg.go.dev/html/template
-	tmpl := template.Must(template.ParseFiles("namespacesindex.html"))
-	tmpl.Execute(w, KeyValueList)
+	KeyValueList := App.convertNamespaceList(request.Api, kvlist, request.Identity)
+	KeyValueList.Page = App.newPage(request)
+	App.renderPage(logger, w, statuscode, "namespacesindex.html", KeyValueList)
 }
 
 func (App *Application) KeysController(w http.ResponseWriter, request *RequestParameters) {
@@ -164,6 +275,7 @@ func (App *Application) KeysController(w http.ResponseWriter, request *RequestPa
 	debugLogger := logger.With(slog.Any("function", "KeysController")).With(slog.Any("struct", "Application"))
 	debugLogger.Debug("Keys Request")
 	statuscode := http.StatusOK
+	pageError := ""
 	if request.Method == "POST" {
 		err := request.orgRequest.ParseForm()
 		if err != nil {
@@ -171,28 +283,79 @@ func (App *Application) KeysController(w http.ResponseWriter, request *RequestPa
 			App.BadRequestHandler(logger, w, request)
 			return
 		} else {
-			debugLogger.Debug("ParseForm", "values", request.orgRequest.PostForm)
+			debugLogger.Debug("ParseForm", "fields", slices.Collect(maps.Keys(request.orgRequest.PostForm)))
+		}
+		err = App.verifyCSRF(request)
+		if err != nil {
+			debugLogger.Debug("CSRF Error", "type", fmt.Sprintf("%t", err), "error", err)
+			App.ForbiddenHandler(logger, w, request)
+			return
 		}
 		function := request.orgRequest.PostFormValue("input")
-		namespace := request.orgRequest.PostFormValue("namespace")
 		requests.WithLabelValues(request.Path, request.Method, function).Inc()
 		key := request.orgRequest.PostFormValue("key")
 		value := request.orgRequest.PostFormValue("value")
+		generator := request.orgRequest.PostFormValue("generator")
+		if !slices.Contains(App.Generators.Names(), generator) {
+			generator = App.Generators.Default(request.Namespace)
+		}
+		if !App.authorize(logger, w, request, request.Namespace, RoleEditor, function) {
+			return
+		}
+		original := request.orgRequest.PostFormValue("original")
+		protection := App.protection(request.Namespace, key)
+		if function == "Rename" {
+			protection.ReadOnly = protection.ReadOnly || App.protection(request.Namespace, original).NoDelete
+		}
+		if function == "Delete" && protection.NoDelete || function != "Delete" && protection.ReadOnly {
+			logger.Info("Protected key", "namespace", request.Namespace, "key", key)
+			App.auditDenied(request, function, request.Namespace, key, "protected key")
+			App.ForbiddenHandler(logger, w, request)
+			return
+		}
 
 		switch function {
 		case "Create", "Update":
+			if invalid := App.validateKeyValue(request.Namespace, key, value); invalid != nil {
+				statuscode, pageError = http.StatusBadRequest, invalid.Error()+", nothing was saved"
+				App.audit(request, function, request.Namespace, key, errors.New("invalid "+App.markedFormat(request.Namespace, key)))
+				break
+			}
 			err = App.KVDBClient.SetKey(logger, request.Namespace, key, value)
+			App.audit(request, function, request.Namespace, key, err)
+		case "Rename":
+			if key == "" || key == original {
+				statuscode, pageError = http.StatusBadRequest, "A new key is required to rename "+original
+				break
+			}
+			if err = App.renameKey(logger, request.Identity.User, request.Namespace, original, key); err != nil {
+				statuscode, pageError = http.StatusConflict, fmt.Sprintf("Renaming %v failed: %v", original, err)
+			}
+			App.audit(request, function, request.Namespace, original, err)
+			err = nil
 		case "Generate":
-			err = App.KVDBClient.Generate(logger, request.Namespace, key)
+			if key == "" && generator != GeneratorBackend {
+				statuscode, pageError = http.StatusBadRequest, "A key is required for generator "+generator
+				break
+			}
+			err = App.generateKey(logger, request.Namespace, key, generator, false)
+			App.audit(request, function, request.Namespace, key, err)
 		case "Roll":
-			err = App.KVDBClient.Roll(logger, request.Namespace, key)
+			if App.binaryKey(logger, request.Namespace, key) {
+				statuscode, pageError = http.StatusBadRequest, fmt.Sprintf("Rolling %v refused, the %v", key, binaryRollError)
+				App.auditDenied(request, function, request.Namespace, key, "file value")
+				break
+			}
+			err = App.generateKey(logger, request.Namespace, key, generator, true)
+			App.audit(request, function, request.Namespace, key, err)
 		case "Delete":
-			if namespace != "" {
-				err = App.KVDBClient.DeleteNamespace(logger, request.Namespace)
-				http.Redirect(w, request.orgRequest, "/v1", http.StatusSeeOther)
+			err = App.deleteKey(logger, request.Identity.User, request.Namespace, key)
+			App.audit(request, function, request.Namespace, key, err)
+			var statusError *HTTPStatusError
+			if errors.As(err, &statusError) && statusError.StatusCode == http.StatusNotFound {
+				logger.Info("Key not found", "namespace", request.Namespace, "key", key, "status", http.StatusNotFound)
+				http.NotFound(w, request.orgRequest)
 				return
-			} else {
-				err = App.KVDBClient.DeleteKey(logger, request.Namespace, key)
 			}
 		default:
 			debugLogger.Debug("Unknown post", "function", function)
@@ -207,17 +370,22 @@ func (App *Application) KeysController(w http.ResponseWriter, request *RequestPa
 		requests.WithLabelValues(request.Path, request.Method, "").Inc()
 		logger.Info("Keys request", "status", statuscode)
 	}
-	kvlist, err := App.KVDBClient.GetKeyList(logger, request.Namespace)
+	kvlist, err := App.keyList(logger, request.Namespace)
 	if err != nil {
 		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
 		App.BadRequestHandler(logger, w, request)
 		return
 	}
-	KeyValueList := App.convertKeyList(request.Api, request.Namespace, kvlist)
-	w.WriteHeader(statuscode)
-	// https://pkg.go.dev/html/template
-	tmpl := template.Must(template.ParseFiles("keysindex.html"))
-	tmpl.Execute(w, KeyValueList)
+	KeyValueList := App.convertKeyList(request.Api, request.Namespace, kvlist, App.role(request.Identity, request.Namespace))
+	KeyValueList.Page = App.newPage(request)
+	KeyValueList.Error = pageError
+	KeyValueList.Generators = App.Generators.Names()
+	KeyValueList.Generator = App.Generators.Default(request.Namespace)
+	if err := App.applyMetadata(logger, &KeyValueList, request.orgRequest.URL.Query().Get("tag")); err != nil {
+		debugLogger.Debug("Metadata Error", "type", fmt.Sprintf("%t", err), "error", err)
+		KeyValueList.Error = fmt.Sprintf("Reading metadata failed: %v", err)
+	}
+	App.renderPage(logger, w, statuscode, "keysindex.html", KeyValueList)
 }
 
 func (App *Application) countRune(s string, r rune) int {
@@ -230,20 +398,33 @@ func (App *Application) countRune(s string, r rune) int {
 	return count
 }
 
-func (App *Application) convertKeyList(api string, namespace string, list []rest.KVPairV2) KeyValueList {
-	systemNS := namespace == "kvdb"
-	kvList := KeyValueList{Api: api, Namespace: namespace}
+func (App *Application) convertKeyList(api string, namespace string, list []rest.KVPairV2, role Role) KeyValueList {
+	kvList := KeyValueList{Page: Page{Api: api}, Namespace: namespace, System: App.protection(namespace, "").NoDelete}
 	for i, pair := range list {
-		readOnly := systemNS && pair.Key == "counter"
-		kvList.Items = append(kvList.Items, KeyValue{Id: i, Key: pair.Key, Value: pair.Value, Lines: App.countRune(pair.Value, '\n'), ReadOnly: readOnly})
+		protection := App.protection(namespace, pair.Key)
+		readOnly := protection.ReadOnly || !role.CanEdit()
+		noDelete := protection.NoDelete || !role.CanEdit()
+		format := App.markedFormat(namespace, pair.Key)
+		if format == "" {
+			format = detectValueFormat(pair.Value)
+		}
+		item := KeyValue{Id: i, Key: pair.Key, Value: pair.Value, Lines: App.countRune(pair.Value, '\n'), ReadOnly: readOnly, NoDelete: noDelete, Format: format}
+		if binary, ok := parseBinaryValue(pair.Value); ok {
+			item.Value, item.Lines, item.Binary = "", 1, binary.Describe()
+		}
+		kvList.Items = append(kvList.Items, item)
 	}
 	return kvList
 }
 
-func (App *Application) convertNamespaceList(api string, list []rest.NamespaceV2) NamespaceKeyValueList {
-	namespaceKeyValueList := NamespaceKeyValueList{Api: api}
-	for i, pair := range list {
-		namespaceKeyValueList.Items = append(namespaceKeyValueList.Items, NamespaceKeyValue{Id: i, Name: pair.Name, Size: pair.Size, Access: pair.Access})
+func (App *Application) convertNamespaceList(api string, list []rest.NamespaceV2, identity Identity) NamespaceKeyValueList {
+	namespaceKeyValueList := NamespaceKeyValueList{Page: Page{Api: api}}
+	for _, pair := range list {
+		role := App.role(identity, pair.Name)
+		if !role.CanView() {
+			continue
+		}
+		namespaceKeyValueList.Items = append(namespaceKeyValueList.Items, NamespaceKeyValue{Id: len(namespaceKeyValueList.Items), Name: pair.Name, Size: pair.Size, Access: pair.Access, Role: role})
 	}
 	return namespaceKeyValueList
 }
@@ -254,3 +435,17 @@ func (App *Application) BadRequestHandler(logger *slog.Logger, w http.ResponseWr
 	w.WriteHeader(http.StatusBadRequest)
 	w.Write([]byte("400 Bad Request"))
 }
+
+func (App *Application) ForbiddenHandler(logger *slog.Logger, w http.ResponseWriter, request *RequestParameters) {
+	logger.Info("Forbidden", "status", 403)
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusForbidden)
+	w.Write([]byte("403 Forbidden"))
+}
+
+func (App *Application) InternalServerErrorHandler(logger *slog.Logger, w http.ResponseWriter) {
+	logger.Info("Internal Server Error", "status", 500)
+	w.Header().Set("Content-Type", "text/html")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte("500 Internal Server Error"))
+}
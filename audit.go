@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	auditPageSize = 50
+	// auditLineMax bounds how much of the end of the audit file is read per event kept in memory.
+	auditLineMax = 1024
+)
+
+type ConfigAudit struct {
+	File   string `mapstructure:"file"`
+	Stdout bool   `mapstructure:"stdout"`
+	Memory int    `mapstructure:"memory"`
+}
+
+// AuditEvent records a state changing action, it must never contain values.
+type AuditEvent struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user"`
+	RemoteAddr string    `json:"remoteAddr"`
+	RequestID  int       `json:"requestId"`
+	Action     string    `json:"action"`
+	Namespace  string    `json:"namespace"`
+	Key        string    `json:"key,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type Auditor struct {
+	config ConfigAudit
+	logger *slog.Logger
+	mutex  sync.Mutex
+	file   *os.File
+	recent []AuditEvent
+}
+
+// NewAuditor opens the audit file and reads the last audit.memory events back from it for the audit page.
+func NewAuditor(config ConfigAudit, logger *slog.Logger) (*Auditor, error) {
+	auditor := &Auditor{config: config, logger: logger}
+	if config.File != "" {
+		file, err := os.OpenFile(config.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		auditor.file = file
+		auditor.recent, err = readAuditTail(config.File, config.Memory)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return auditor, nil
+}
+
+// readAuditTail returns up to count events from the end of the file without reading more than count*auditLineMax bytes.
+func readAuditTail(name string, count int) ([]AuditEvent, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := max(info.Size()-int64(count)*auditLineMax, 0)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var events []AuditEvent
+	scanner := bufio.NewScanner(file)
+	if offset > 0 {
+		// the first line is most likely cut
+		scanner.Scan()
+	}
+	for scanner.Scan() {
+		var event AuditEvent
+		if json.Unmarshal(scanner.Bytes(), &event) == nil {
+			events = append(events, event)
+		}
+	}
+	if len(events) > count {
+		events = events[len(events)-count:]
+	}
+	return events, scanner.Err()
+}
+
+func (a *Auditor) Record(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.config.Memory > 0 {
+		a.recent = append(a.recent, event)
+		if len(a.recent) > a.config.Memory {
+			a.recent = a.recent[len(a.recent)-a.config.Memory:]
+		}
+	}
+	if a.config.Stdout && a.logger != nil {
+		a.logger.Info("Audit", slog.Group("audit", "user", event.User, "action", event.Action, "namespace", event.Namespace, "key", event.Key, "outcome", event.Outcome, "error", event.Error, "requestId", event.RequestID, "remoteAddr", event.RemoteAddr))
+	}
+	if a.file != nil {
+		_, err = a.file.Write(line)
+	}
+	return err
+}
+
+// Events returns the last audit.memory events oldest first.
+func (a *Auditor) Events() []AuditEvent {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return slices.Clone(a.recent)
+}
+
+func auditOutcome(err error) (string, string) {
+	if err != nil {
+		return "failure", err.Error()
+	}
+	return "success", ""
+}
+
+// audit records an action performed on behalf of the request, err decides the outcome.
+func (App *Application) audit(request *RequestParameters, action string, namespace string, key string, err error) {
+	event := AuditEvent{Time: time.Now().UTC(), User: request.Identity.User, RemoteAddr: request.orgRequest.RemoteAddr, RequestID: request.ID, Action: action, Namespace: namespace, Key: key}
+	event.Outcome, event.Error = auditOutcome(err)
+	App.recordAudit(event)
+}
+
+// auditDenied records an action that was refused before reaching the backend.
+func (App *Application) auditDenied(request *RequestParameters, action string, namespace string, key string, reason string) {
+	App.recordAudit(AuditEvent{Time: time.Now().UTC(), User: request.Identity.User, RemoteAddr: request.orgRequest.RemoteAddr, RequestID: request.ID, Action: action, Namespace: namespace, Key: key, Outcome: "denied", Error: reason})
+}
+
+func (App *Application) recordAudit(event AuditEvent) {
+	if err := App.Auditor.Record(event); err != nil {
+		App.Logger.Error("Audit write failed", "error", err, "function", "recordAudit", "struct", "Application")
+	}
+}
+
+func (App *Application) auditResults(request *RequestParameters, action string, namespace string, results []KeyResult) {
+	for _, result := range results {
+		if result.Result == "Skipped" || result.Result == "Unchanged" {
+			continue
+		}
+		event := AuditEvent{Time: time.Now().UTC(), User: request.Identity.User, RemoteAddr: request.orgRequest.RemoteAddr, RequestID: request.ID, Action: action, Namespace: namespace, Key: result.Key, Outcome: "success"}
+		if result.Error != "" {
+			event.Outcome, event.Error = "failure", result.Error
+		}
+		App.recordAudit(event)
+	}
+}
+
+type AuditFilter struct {
+	User      string
+	Action    string
+	Namespace string
+	Outcome   string
+}
+
+func (f AuditFilter) Match(event AuditEvent) bool {
+	return (f.User == "" || f.User == event.User) &&
+		(f.Action == "" || f.Action == event.Action) &&
+		(f.Namespace == "" || f.Namespace == event.Namespace) &&
+		(f.Outcome == "" || f.Outcome == event.Outcome)
+}
+
+type AuditList struct {
+	Page
+	Filter     AuditFilter
+	Events     []AuditEvent
+	PageNumber int
+	Previous   string
+	Next       string
+}
+
+func (f AuditFilter) query(pageNumber int) string {
+	values := url.Values{}
+	for name, value := range map[string]string{"user": f.User, "action": f.Action, "namespace": f.Namespace, "outcome": f.Outcome} {
+		if value != "" {
+			values.Set(name, value)
+		}
+	}
+	values.Set("page", strconv.Itoa(pageNumber))
+	return "?" + values.Encode()
+}
+
+// AuditController shows the audit log newest first, filtered by the query parameters.
+func (App *Application) AuditController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "AuditController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Audit Request")
+	requests.WithLabelValues(request.Path, request.Method, "").Inc()
+	query := request.orgRequest.URL.Query()
+	list := AuditList{Page: App.newPage(request), Filter: AuditFilter{User: query.Get("user"), Action: query.Get("action"), Namespace: query.Get("namespace"), Outcome: query.Get("outcome")}}
+	list.Api = "v1"
+	list.PageNumber, _ = strconv.Atoi(query.Get("page"))
+	list.PageNumber = max(list.PageNumber, 1)
+	events := App.Auditor.Events()
+	var matching []AuditEvent
+	for i := len(events) - 1; i >= 0; i-- {
+		if list.Filter.Match(events[i]) {
+			matching = append(matching, events[i])
+		}
+	}
+	start := (list.PageNumber - 1) * auditPageSize
+	if start < len(matching) {
+		list.Events = matching[start:min(start+auditPageSize, len(matching))]
+	}
+	if list.PageNumber > 1 {
+		list.Previous = list.Filter.query(list.PageNumber - 1)
+	}
+	if start+auditPageSize < len(matching) {
+		list.Next = list.Filter.query(list.PageNumber + 1)
+	}
+	logger.Info("Audit request", "status", http.StatusOK)
+	App.renderPage(logger, w, http.StatusOK, "audit.html", list)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestAuditorKeepsTailOfFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.log")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	auditor, err := NewAuditor(ConfigAudit{File: name, Memory: 5}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5000 {
+		if err := auditor.Record(AuditEvent{User: "alice", Action: "Update", Key: strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if events := auditor.Events(); len(events) != 5 || events[0].Key != "4995" || events[4].Key != "4999" {
+		t.Fatalf("unexpected events in memory %+v", events)
+	}
+	reopened, err := NewAuditor(ConfigAudit{File: name, Memory: 3}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := reopened.Events()
+	if len(events) != 3 || events[0].Key != "4997" || events[2].Key != "4999" {
+		t.Fatalf("unexpected events read back %+v", events)
+	}
+	reopened.Record(AuditEvent{Key: "5000"})
+	if events := reopened.Events(); len(events) != 3 || events[2].Key != "5000" {
+		t.Fatalf("unexpected events after record %+v", events)
+	}
+}
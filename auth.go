@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+// AuthController handles /auth/login, /auth/callback and /auth/logout for the built in authentication modes.
+func (App *Application) AuthController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "AuthController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Auth Request", "mode", App.Config.Auth.Mode)
+	requests.WithLabelValues(request.Path, request.Method, request.Namespace).Inc()
+	if !App.sessionAuth() {
+		http.NotFound(w, request.orgRequest)
+		return
+	}
+	switch request.Namespace {
+	case "login":
+		if App.Config.Auth.Mode == "local" {
+			App.LocalLogin(w, request, logger)
+			return
+		}
+		App.OIDCLogin(w, request, logger)
+	case "callback":
+		if App.Config.Auth.Mode != "oidc" {
+			http.NotFound(w, request.orgRequest)
+			return
+		}
+		App.OIDCCallback(w, request, logger)
+	case "logout":
+		if request.Method != "POST" {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, fmt.Sprintf("%v Method Not Allowed", http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if !App.parsePost(logger, w, request) {
+			return
+		}
+		if App.Config.Auth.Mode == "local" {
+			App.LocalLogout(w, request, logger)
+			return
+		}
+		App.OIDCLogout(w, request, logger)
+	default:
+		http.NotFound(w, request.orgRequest)
+	}
+}
+
+// requireLogin redirects requests without a session to the login page, it returns false when the request was redirected.
+func (App *Application) requireLogin(w http.ResponseWriter, request *RequestParameters) bool {
+	if !App.sessionAuth() || request.Identity.User != "" {
+		return true
+	}
+	http.Redirect(w, request.orgRequest, "/auth/login?next="+url.QueryEscape(request.orgRequest.URL.RequestURI()), http.StatusSeeOther)
+	return false
+}
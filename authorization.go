@@ -0,0 +1,153 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleEditor
+	RoleAdmin
+)
+
+var roleNames = []string{"none", "viewer", "editor", "admin"}
+
+func ParseRole(name string) Role {
+	index := slices.Index(roleNames, strings.ToLower(name))
+	if index < 0 {
+		return RoleNone
+	}
+	return Role(index)
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+func (r Role) CanView() bool  { return r >= RoleViewer }
+func (r Role) CanEdit() bool  { return r >= RoleEditor }
+func (r Role) CanAdmin() bool { return r >= RoleAdmin }
+
+type ConfigAuthorization struct {
+	Enabled bool                      `mapstructure:"enabled"`
+	Rules   []ConfigAuthorizationRule `mapstructure:"rules"`
+}
+
+// ConfigAuthorizationRule grants Role on namespaces matching one of the Namespaces patterns to the listed users and groups.
+type ConfigAuthorizationRule struct {
+	Users      []string `mapstructure:"users"`
+	Groups     []string `mapstructure:"groups"`
+	Namespaces []string `mapstructure:"namespaces"`
+	Role       string   `mapstructure:"role"`
+}
+
+func (rule ConfigAuthorizationRule) appliesTo(identity Identity) bool {
+	if identity.User != "" && slices.Contains(rule.Users, identity.User) {
+		return true
+	}
+	return slices.ContainsFunc(identity.Groups, func(group string) bool { return slices.Contains(rule.Groups, group) })
+}
+
+func (rule ConfigAuthorizationRule) matchesNamespace(namespace string) bool {
+	return matchPatterns(rule.Namespaces, namespace)
+}
+
+// role returns the highest role the identity holds on the namespace, everyone is admin when authorization is disabled.
+// Read-only instances and protected namespaces limit the role further.
+func (App *Application) role(identity Identity, namespace string) Role {
+	if !App.Config.Authorization.Enabled {
+		return App.protectedRole(namespace, App.readOnlyRole(RoleAdmin))
+	}
+	role := RoleNone
+	for _, rule := range App.Config.Authorization.Rules {
+		if rule.appliesTo(identity) && rule.matchesNamespace(namespace) {
+			role = max(role, ParseRole(rule.Role))
+		}
+	}
+	return App.protectedRole(namespace, App.readOnlyRole(role))
+}
+
+// roleAny returns the highest role the identity holds on any namespace.
+func (App *Application) roleAny(identity Identity) Role {
+	if !App.Config.Authorization.Enabled {
+		return App.readOnlyRole(RoleAdmin)
+	}
+	role := RoleNone
+	for _, rule := range App.Config.Authorization.Rules {
+		if rule.appliesTo(identity) {
+			role = max(role, ParseRole(rule.Role))
+		}
+	}
+	return App.readOnlyRole(role)
+}
+
+// globalAdmin reports if the identity is admin on all namespaces through a rule for "*", everyone is when authorization
+// is disabled. Read-only instances only keep it for pages that view data.
+func (App *Application) globalAdmin(identity Identity, viewOnly bool) bool {
+	role := RoleAdmin
+	if App.Config.Authorization.Enabled {
+		role = RoleNone
+		for _, rule := range App.Config.Authorization.Rules {
+			if rule.appliesTo(identity) && rule.matchesNamespace("*") {
+				role = max(role, ParseRole(rule.Role))
+			}
+		}
+	}
+	if !viewOnly {
+		role = App.readOnlyRole(role)
+	}
+	return role.CanAdmin()
+}
+
+// canCreateNamespaces reports if the identity is admin on any namespace, which namespaces it may create is checked on creation.
+func (App *Application) canCreateNamespaces(identity Identity) bool {
+	return App.roleAny(identity).CanAdmin()
+}
+
+// readOnlyRole limits every role to viewer when the instance is read-only.
+func (App *Application) readOnlyRole(role Role) Role {
+	if App.Config.ReadOnly {
+		return min(role, RoleViewer)
+	}
+	return role
+}
+
+// rejectReadOnly answers every request that could change state with 403 when the instance is read-only.
+func (App *Application) rejectReadOnly(logger *slog.Logger, w http.ResponseWriter, request *RequestParameters) bool {
+	if !App.Config.ReadOnly || request.Method == "GET" || request.Method == "HEAD" {
+		return false
+	}
+	logger.Info("Read-only instance", "user", request.Identity.User)
+	App.auditDenied(request, request.Method, request.Namespace, "", "read-only instance")
+	App.ForbiddenHandler(logger, w, request)
+	return true
+}
+
+// authorizeGlobal checks globalAdmin for the pages that are not about one namespace, GET and HEAD requests only view data.
+func (App *Application) authorizeGlobal(logger *slog.Logger, w http.ResponseWriter, request *RequestParameters, action string) bool {
+	if App.globalAdmin(request.Identity, request.Method == "GET" || request.Method == "HEAD") {
+		return true
+	}
+	logger.Info("Authorization denied", "user", request.Identity.User, "namespace", "*", "required", RoleAdmin.String())
+	App.auditDenied(request, action, "*", "", "requires role admin on all namespaces")
+	App.ForbiddenHandler(logger, w, request)
+	return false
+}
+
+// authorize checks that the request holds the required role on the namespace, refused requests are audited and answered with 403.
+func (App *Application) authorize(logger *slog.Logger, w http.ResponseWriter, request *RequestParameters, namespace string, required Role, action string) bool {
+	role := App.role(request.Identity, namespace)
+	if role >= required {
+		return true
+	}
+	logger.Info("Authorization denied", "user", request.Identity.User, "namespace", namespace, "role", role.String(), "required", required.String())
+	App.auditDenied(request, action, namespace, "", "requires role "+required.String())
+	App.ForbiddenHandler(logger, w, request)
+	return false
+}
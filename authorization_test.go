@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestGlobalAdmin(t *testing.T) {
+	rules := []ConfigAuthorizationRule{
+		{Groups: []string{"ops"}, Namespaces: []string{"*"}, Role: "admin"},
+		{Groups: []string{"auditors"}, Namespaces: []string{"*"}, Role: "viewer"},
+		{Users: []string{"alice"}, Namespaces: []string{"app-*"}, Role: "admin"},
+	}
+	tests := []struct {
+		name      string
+		disabled  bool
+		readOnly  bool
+		identity  Identity
+		viewOnly  bool
+		admin     bool
+		canCreate bool
+	}{
+		{name: "admin on all namespaces", identity: Identity{User: "bob", Groups: []string{"ops"}}, admin: true, canCreate: true},
+		{name: "viewer on all namespaces", identity: Identity{User: "carol", Groups: []string{"auditors"}}, viewOnly: true},
+		{name: "admin on some namespaces", identity: Identity{User: "alice"}, viewOnly: true, canCreate: true},
+		{name: "read-only view", readOnly: true, identity: Identity{User: "bob", Groups: []string{"ops"}}, viewOnly: true, admin: true},
+		{name: "read-only change", readOnly: true, identity: Identity{User: "bob", Groups: []string{"ops"}}},
+		{name: "authorization disabled", disabled: true, admin: true, canCreate: true},
+		{name: "authorization disabled read-only view", disabled: true, readOnly: true, viewOnly: true, admin: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			App := new(Application)
+			App.Config.Authorization = ConfigAuthorization{Enabled: !test.disabled, Rules: rules}
+			App.Config.ReadOnly = test.readOnly
+			if admin := App.globalAdmin(test.identity, test.viewOnly); admin != test.admin {
+				t.Fatalf("expected globalAdmin %v, got %v", test.admin, admin)
+			}
+			if canCreate := App.canCreateNamespaces(test.identity); canCreate != test.canCreate {
+				t.Fatalf("expected canCreateNamespaces %v, got %v", test.canCreate, canCreate)
+			}
+		})
+	}
+}
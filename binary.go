@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+type ConfigValues struct {
+	MaxFileSize       int64  `mapstructure:"maxFileSize"`
+	FingerprintSecret string `mapstructure:"fingerprintSecret"`
+}
+
+// BinaryValue is a file stored in a key as a data URI, data:<content-type>;name=<file name>;base64,<data>.
+type BinaryValue struct {
+	ContentType string
+	FileName    string
+	Data        []byte
+}
+
+func (b BinaryValue) Encode() string {
+	return "data:" + b.ContentType + ";name=" + url.PathEscape(b.FileName) + ";base64," + base64.StdEncoding.EncodeToString(b.Data)
+}
+
+// Describe summarises the file for the key list instead of showing the encoded data.
+func (b BinaryValue) Describe() string {
+	description := "binary, " + humanSize(len(b.Data))
+	if b.FileName != "" {
+		description += ", " + b.FileName
+	}
+	return description
+}
+
+// parseBinaryValue recognises values written by Encode, other values are text.
+func parseBinaryValue(value string) (BinaryValue, bool) {
+	header, encoded, found := strings.Cut(value, ";base64,")
+	if !found || !strings.HasPrefix(header, "data:") {
+		return BinaryValue{}, false
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return BinaryValue{}, false
+	}
+	binary := BinaryValue{Data: data}
+	for i, part := range strings.Split(strings.TrimPrefix(header, "data:"), ";") {
+		if i == 0 {
+			binary.ContentType = part
+		} else if name, found := strings.CutPrefix(part, "name="); found {
+			binary.FileName, _ = url.PathUnescape(name)
+		}
+	}
+	if binary.ContentType == "" {
+		binary.ContentType = "application/octet-stream"
+	}
+	return binary, true
+}
+
+// binaryRollError is the result of rolling a file value, rolling would replace the file with a text value.
+const binaryRollError = "key holds a file, upload a new file instead of rolling it"
+
+// binaryKey reports if the key holds a file, keys that can not be read are left to the action itself.
+func (App *Application) binaryKey(logger *slog.Logger, namespace string, key string) bool {
+	pair, err := App.KVDBClient.GetKey(logger, namespace, key)
+	if err != nil {
+		return false
+	}
+	_, binary := parseBinaryValue(pair.Value)
+	return binary
+}
+
+func humanSize(size int) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value, unit := float64(size)/1024, "KB"
+	if value >= 1024 {
+		value, unit = value/1024, "MB"
+	}
+	return fmt.Sprintf("%.1f %v", value, unit)
+}
+
+type KeyUpload struct {
+	Page
+	Namespace   string
+	Key         string
+	MaxFileSize string
+	Error       string
+}
+
+// KeyUploadController stores an uploaded file in a key as a data URI.
+func (App *Application) KeyUploadController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "KeyUploadController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Key Upload Request")
+	statuscode := http.StatusOK
+	maxFileSize := App.Config.Values.MaxFileSize
+	page := KeyUpload{Page: App.newPage(request), Namespace: request.Namespace, Key: request.orgRequest.URL.Query().Get("key"), MaxFileSize: humanSize(int(maxFileSize))}
+	if request.Method != "POST" {
+		requests.WithLabelValues(request.Path, request.Method, "").Inc()
+		logger.Info("Key upload request", "status", statuscode)
+		App.renderPage(logger, w, statuscode, "keyupload.html", page)
+		return
+	}
+	request.orgRequest.Body = http.MaxBytesReader(w, request.orgRequest.Body, maxFileSize+64*1024)
+	if err := request.orgRequest.ParseMultipartForm(maxFileSize + 64*1024); err != nil {
+		debugLogger.Debug("ParseMultipartForm Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	if !App.parsePost(logger, w, request) {
+		return
+	}
+	requests.WithLabelValues(request.Path, request.Method, "Upload").Inc()
+	page.Key = strings.TrimSpace(request.orgRequest.PostFormValue("key"))
+	if !App.authorize(logger, w, request, request.Namespace, RoleEditor, "Upload") {
+		return
+	}
+	binary, err := readUploadedFile(request.orgRequest, maxFileSize)
+	if err == nil && page.Key == "" {
+		page.Key = binary.FileName
+	}
+	if err == nil && page.Key == "" {
+		err = fmt.Errorf("a key is required")
+	}
+	if err == nil && !App.keyWritable(request.Namespace, page.Key) {
+		App.auditDenied(request, "Upload", request.Namespace, page.Key, "protected key")
+		App.ForbiddenHandler(logger, w, request)
+		return
+	}
+	if err == nil {
+		err = App.KVDBClient.SetKey(logger, request.Namespace, page.Key, binary.Encode())
+		App.audit(request, "Upload", request.Namespace, page.Key, err)
+		if err == nil {
+			logger.Info("File uploaded", "namespace", request.Namespace, "key", page.Key, "size", len(binary.Data), "status", http.StatusSeeOther)
+			http.Redirect(w, request.orgRequest, "/"+request.Api+"/"+request.Namespace+"/", http.StatusSeeOther)
+			return
+		}
+		statuscode = http.StatusBadGateway
+	} else {
+		statuscode = http.StatusBadRequest
+	}
+	page.Error = fmt.Sprintf("Upload failed: %v", err)
+	logger.Info("Key upload request", "status", statuscode)
+	App.renderPage(logger, w, statuscode, "keyupload.html", page)
+}
+
+func readUploadedFile(r *http.Request, maxFileSize int64) (BinaryValue, error) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return BinaryValue{}, fmt.Errorf("no file uploaded")
+	}
+	defer file.Close()
+	if header.Size > maxFileSize {
+		return BinaryValue{}, fmt.Errorf("file is larger than %v", humanSize(int(maxFileSize)))
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxFileSize+1))
+	if err != nil {
+		return BinaryValue{}, err
+	}
+	if int64(len(data)) > maxFileSize {
+		return BinaryValue{}, fmt.Errorf("file is larger than %v", humanSize(int(maxFileSize)))
+	}
+	contentType := header.Header.Get("Content-Type")
+	if _, _, err := mime.ParseMediaType(contentType); err != nil || contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	contentType, _, _ = strings.Cut(contentType, ";")
+	binary := BinaryValue{ContentType: contentType, FileName: path.Base(header.Filename), Data: data}
+	if binary.FileName == "." || binary.FileName == "/" {
+		binary.FileName = ""
+	}
+	return binary, nil
+}
+
+// KeyDownloadController returns the original bytes of a file value, text values are returned as they are.
+func (App *Application) KeyDownloadController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "KeyDownloadController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Key Download Request")
+	requests.WithLabelValues(request.Path, request.Method, "Download").Inc()
+	key := request.orgRequest.URL.Query().Get("key")
+	kvlist, err := App.keyList(logger, request.Namespace)
+	if err != nil {
+		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	value, exists := pairsToMap(kvlist)[key]
+	if !exists {
+		logger.Info("Key not found", "namespace", request.Namespace, "key", key, "status", http.StatusNotFound)
+		http.NotFound(w, request.orgRequest)
+		return
+	}
+	binary, isBinary := parseBinaryValue(value)
+	if !isBinary {
+		binary = BinaryValue{ContentType: "text/plain; charset=utf-8", Data: []byte(value)}
+	}
+	if binary.FileName == "" {
+		binary.FileName = key
+	}
+	if _, _, err := mime.ParseMediaType(binary.ContentType); err != nil {
+		binary.ContentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", binary.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": binary.FileName}))
+	w.Header().Set("Content-Length", fmt.Sprint(len(binary.Data)))
+	logger.Info("Key download request", "namespace", request.Namespace, "key", key, "status", http.StatusOK)
+	w.Write(binary.Data)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/SimonStiil/keyvaluedatabase/rest"
+)
+
+type KeyBulk struct {
+	Page
+	Namespace string
+	Action    string
+	Target    string
+	Results   []KeyResult
+	Error     string
+}
+
+// bulkActions maps the actions of the bulk form to the role they require.
+var bulkActions = map[string]Role{"Roll": RoleEditor, "Delete": RoleEditor, "Copy": RoleViewer, "Export": RoleViewer}
+
+// KeyBulkController runs one action on all keys selected in the key table and shows a summary of the results.
+func (App *Application) KeyBulkController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "KeyBulkController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Key Bulk Request")
+	if request.Method != "POST" {
+		http.Redirect(w, request.orgRequest, "/"+request.Api+"/"+request.Namespace+"/", http.StatusSeeOther)
+		return
+	}
+	if !App.parsePost(logger, w, request) {
+		return
+	}
+	statuscode := http.StatusOK
+	form := request.orgRequest.PostForm
+	page := KeyBulk{Page: App.newPage(request), Namespace: request.Namespace, Action: form.Get("input"), Target: form.Get("target")}
+	requests.WithLabelValues(request.Path, request.Method, "Bulk"+page.Action).Inc()
+	required, ok := bulkActions[page.Action]
+	if !ok {
+		debugLogger.Debug("Unknown post", "function", page.Action)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	if !App.authorize(logger, w, request, request.Namespace, required, page.Action) {
+		return
+	}
+	selected := form["keys"]
+	if len(selected) == 0 {
+		logger.Info("Key bulk request", "action", page.Action, "keys", 0, "status", http.StatusBadRequest)
+		page.Error = "No keys were selected"
+		App.renderPage(logger, w, http.StatusBadRequest, "keybulk.html", page)
+		return
+	}
+	if page.Action == "Export" {
+		http.Redirect(w, request.orgRequest, "/"+request.Api+"/"+request.Namespace+"/export?"+url.Values{"keys": selected}.Encode(), http.StatusSeeOther)
+		return
+	}
+	kvlist, err := App.keyList(logger, request.Namespace)
+	if err != nil {
+		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	switch {
+	case page.Action == "Copy":
+		if !App.authorize(logger, w, request, page.Target, RoleEditor, "Copy") {
+			return
+		}
+		statuscode, page.Error = App.bulkCopy(logger, request, &page, kvlist, selected)
+	default:
+		page.Results = App.bulkKeys(logger, request.Identity.User, request.Namespace, page.Action, kvlist, selected, form.Get("generator"))
+		App.auditResults(request, page.Action, request.Namespace, page.Results)
+	}
+	logger.Info("Key bulk request", "action", page.Action, "keys", len(selected), "status", statuscode)
+	App.renderPage(logger, w, statuscode, "keybulk.html", page)
+}
+
+// bulkKeys rolls or deletes each selected key that exists in the namespace.
+func (App *Application) bulkKeys(logger *slog.Logger, user string, namespace string, action string, kvlist []rest.KVPairV2, selected []string, generator string) []KeyResult {
+	existing := pairsToMap(kvlist)
+	if !slices.Contains(App.Generators.Names(), generator) {
+		generator = App.Generators.Default(namespace)
+	}
+	var results []KeyResult
+	App.batchMetadata(logger, namespace, func() {
+		for _, key := range selected {
+			protection := App.protection(namespace, key)
+			var result KeyResult
+			var err error
+			_, binary := parseBinaryValue(existing[key])
+			switch _, exists := existing[key]; {
+			case !exists:
+				result = KeyResult{Key: key, Result: "Failed", Error: "key not found"}
+			case action == "Roll" && protection.ReadOnly, action == "Delete" && protection.NoDelete:
+				result = protectedKeyResult(key)
+			case action == "Roll" && binary:
+				result = KeyResult{Key: key, Result: "Failed", Error: binaryRollError}
+			case action == "Roll":
+				result = KeyResult{Key: key, Result: "Rolled"}
+				err = App.generateKey(logger, namespace, key, generator, true)
+			case action == "Delete":
+				result = KeyResult{Key: key, Result: "Deleted"}
+				err = App.deleteKey(logger, user, namespace, key)
+			}
+			if err != nil {
+				result.Result, result.Error = "Failed", err.Error()
+			}
+			results = append(results, result)
+		}
+	})
+	return results
+}
+
+// bulkCopy copies the selected keys into an existing namespace, keys that already exist there are skipped.
+func (App *Application) bulkCopy(logger *slog.Logger, request *RequestParameters, page *KeyBulk, kvlist []rest.KVPairV2, selected []string) (int, string) {
+	if page.Target == "" || page.Target == request.Namespace {
+		return http.StatusBadRequest, "Another namespace is required to copy to"
+	}
+	exists, err := App.namespaceExists(logger, page.Target)
+	if err != nil {
+		return http.StatusBadGateway, fmt.Sprintf("Listing namespaces failed: %v", err)
+	}
+	if !exists {
+		return http.StatusNotFound, fmt.Sprintf("Namespace %v does not exist", page.Target)
+	}
+	target, err := App.keyList(logger, page.Target)
+	if err != nil {
+		return http.StatusBadGateway, fmt.Sprintf("Reading namespace %v failed: %v", page.Target, err)
+	}
+	page.Results = App.copyMissing(logger, kvlist, target, page.Target, selected)
+	App.auditResults(request, "Copy", page.Target, page.Results)
+	return http.StatusOK, ""
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/SimonStiil/keyvaluedatabase/rest"
+)
+
+// KeyResult is the outcome of an action on a single key, shown in result tables.
+type KeyResult struct {
+	Key    string
+	Result string
+	Error  string
+}
+
+type CloneKey struct {
+	Key      string
+	Selected bool
+}
+
+type NamespaceClone struct {
+	Page
+	Namespace  string
+	Target     string
+	Regenerate bool
+	Keys       []CloneKey
+	Results    []KeyResult
+	Error      string
+}
+
+func (App *Application) namespaceExists(logger *slog.Logger, namespace string) (bool, error) {
+	namespaces, err := App.KVDBClient.GetNamespaceList(logger)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(namespaces, func(existing rest.NamespaceV2) bool { return existing.Name == namespace }), nil
+}
+
+// NamespaceCloneController copies all or selected keys of a namespace into a new namespace.
+func (App *Application) NamespaceCloneController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "NamespaceCloneController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Namespace Clone Request")
+	if !App.canCreateNamespaces(request.Identity) {
+		logger.Info("Authorization denied", "user", request.Identity.User, "namespace", request.Namespace, "required", RoleAdmin.String())
+		App.auditDenied(request, "Clone", request.Namespace, "", "requires role admin on a namespace")
+		App.ForbiddenHandler(logger, w, request)
+		return
+	}
+	statuscode := http.StatusOK
+	kvlist, err := App.keyList(logger, request.Namespace)
+	if err != nil {
+		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	page := NamespaceClone{Page: App.newPage(request), Namespace: request.Namespace}
+	if request.Method == "POST" {
+		if !App.parsePost(logger, w, request) {
+			return
+		}
+		requests.WithLabelValues(request.Path, request.Method, "Clone").Inc()
+		page.Target = request.orgRequest.PostFormValue("target")
+		page.Regenerate = request.orgRequest.PostFormValue("regenerate") != ""
+		selected := request.orgRequest.PostForm["keys"]
+		for _, pair := range kvlist {
+			page.Keys = append(page.Keys, CloneKey{Key: pair.Key, Selected: slices.Contains(selected, pair.Key)})
+		}
+		if !App.authorize(logger, w, request, page.Target, RoleAdmin, "Clone") {
+			return
+		}
+		statuscode, page.Error = App.validateCloneTarget(logger, request.Namespace, page.Target)
+		if page.Error == "" {
+			err = App.KVDBClient.CreateNamespace(logger, page.Target)
+			App.audit(request, "CreateNamespace", page.Target, "", err)
+			if err != nil {
+				debugLogger.Debug("CreateNamespace Error", "type", fmt.Sprintf("%t", err), "error", err)
+				statuscode = http.StatusBadGateway
+				page.Error = fmt.Sprintf("Creating namespace %v failed: %v", page.Target, err)
+			} else {
+				page.Results = App.cloneKeys(logger, page.Target, kvlist, selected, page.Regenerate)
+				App.auditResults(request, "Clone", page.Target, page.Results)
+				logger.Info("Namespace cloned", "namespace", request.Namespace, "target", page.Target, "keys", len(page.Results))
+			}
+		}
+	} else {
+		requests.WithLabelValues(request.Path, request.Method, "").Inc()
+		for _, pair := range kvlist {
+			page.Keys = append(page.Keys, CloneKey{Key: pair.Key, Selected: true})
+		}
+	}
+	logger.Info("Namespace clone request", "status", statuscode)
+	App.renderPage(logger, w, statuscode, "namespaceclone.html", page)
+}
+
+func (App *Application) validateCloneTarget(logger *slog.Logger, source string, target string) (int, string) {
+	if target == "" || target == source {
+		return http.StatusBadRequest, "A new namespace name is required"
+	}
+	exists, err := App.namespaceExists(logger, target)
+	if err != nil {
+		return http.StatusBadGateway, fmt.Sprintf("Listing namespaces failed: %v", err)
+	}
+	if exists {
+		return http.StatusConflict, fmt.Sprintf("Namespace %v already exists", target)
+	}
+	return http.StatusOK, ""
+}
+
+func (App *Application) cloneKeys(logger *slog.Logger, target string, kvlist []rest.KVPairV2, selected []string, regenerate bool) []KeyResult {
+	var results []KeyResult
+	App.batchMetadata(logger, target, func() {
+		for _, pair := range kvlist {
+			if !slices.Contains(selected, pair.Key) {
+				continue
+			}
+			if !App.keyWritable(target, pair.Key) {
+				results = append(results, protectedKeyResult(pair.Key))
+				continue
+			}
+			result := KeyResult{Key: pair.Key, Result: "Copied"}
+			var err error
+			if regenerate {
+				result.Result = "Generated"
+				err = App.generateKey(logger, target, pair.Key, App.Generators.Default(target), false)
+			} else {
+				err = App.KVDBClient.SetKey(logger, target, pair.Key, pair.Value)
+			}
+			if err != nil {
+				result.Result = "Failed"
+				result.Error = err.Error()
+			}
+			results = append(results, result)
+		}
+	})
+	return results
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/SimonStiil/keyvaluedatabase/rest"
+)
+
+type CompareKey struct {
+	Key    string
+	ValueA string
+	ValueB string
+}
+
+type NamespaceCompare struct {
+	Page
+	Namespace  string
+	Other      string
+	Namespaces []string
+	Reveal     bool
+	OnlyA      []CompareKey
+	OnlyB      []CompareKey
+	Different  []CompareKey
+	Identical  []CompareKey
+	Results    []KeyResult
+	Error      string
+}
+
+func (page *NamespaceCompare) compare(fingerprintKey []byte, listA []rest.KVPairV2, listB []rest.KVPairV2) {
+	valuesA, valuesB := pairsToMap(listA), pairsToMap(listB)
+	show := func(value string) string { return ValueFingerprint(fingerprintKey, value) }
+	if page.Reveal {
+		show = func(value string) string { return value }
+	}
+	for _, pair := range listA {
+		valueB, exists := valuesB[pair.Key]
+		switch {
+		case !exists:
+			page.OnlyA = append(page.OnlyA, CompareKey{Key: pair.Key, ValueA: show(pair.Value)})
+		case valueB == pair.Value:
+			page.Identical = append(page.Identical, CompareKey{Key: pair.Key, ValueA: show(pair.Value), ValueB: show(valueB)})
+		default:
+			page.Different = append(page.Different, CompareKey{Key: pair.Key, ValueA: show(pair.Value), ValueB: show(valueB)})
+		}
+	}
+	for _, pair := range listB {
+		if _, exists := valuesA[pair.Key]; !exists {
+			page.OnlyB = append(page.OnlyB, CompareKey{Key: pair.Key, ValueB: show(pair.Value)})
+		}
+	}
+	for _, keys := range [][]CompareKey{page.OnlyA, page.OnlyB, page.Different, page.Identical} {
+		slices.SortFunc(keys, func(a, b CompareKey) int { return strings.Compare(a.Key, b.Key) })
+	}
+}
+
+// copyMissing copies the selected keys from source to target, keys that already exist in target are never overwritten.
+func (App *Application) copyMissing(logger *slog.Logger, source []rest.KVPairV2, target []rest.KVPairV2, targetNamespace string, selected []string) []KeyResult {
+	existing := pairsToMap(target)
+	var results []KeyResult
+	App.batchMetadata(logger, targetNamespace, func() {
+		for _, pair := range source {
+			if !slices.Contains(selected, pair.Key) {
+				continue
+			}
+			result := KeyResult{Key: pair.Key, Result: "Copied to " + targetNamespace}
+			if _, exists := existing[pair.Key]; exists {
+				result.Result = "Skipped"
+				result.Error = "key already exists in " + targetNamespace
+			} else if !App.keyWritable(targetNamespace, pair.Key) {
+				result = protectedKeyResult(pair.Key)
+			} else if err := App.KVDBClient.SetKey(logger, targetNamespace, pair.Key, pair.Value); err != nil {
+				result.Result = "Failed"
+				result.Error = err.Error()
+			}
+			results = append(results, result)
+		}
+	})
+	return results
+}
+
+// NamespaceCompareController compares the namespace with the namespace given in b and copies missing keys between them.
+func (App *Application) NamespaceCompareController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "NamespaceCompareController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Namespace Compare Request")
+	statuscode := http.StatusOK
+	query := request.orgRequest.URL.Query()
+	page := NamespaceCompare{Page: App.newPage(request), Namespace: request.Namespace, Other: query.Get("b"), Reveal: query.Get("reveal") != ""}
+	namespaces, err := App.KVDBClient.GetNamespaceList(logger)
+	if err != nil {
+		debugLogger.Debug("GetNamespaceList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	for _, namespace := range namespaces {
+		if namespace.Name != request.Namespace && App.role(request.Identity, namespace.Name).CanView() {
+			page.Namespaces = append(page.Namespaces, namespace.Name)
+		}
+	}
+	if request.Method == "POST" {
+		if !App.parsePost(logger, w, request) {
+			return
+		}
+		page.Other = request.orgRequest.PostFormValue("b")
+	}
+	if page.Other == "" {
+		requests.WithLabelValues(request.Path, request.Method, "").Inc()
+		logger.Info("Namespace compare request", "status", statuscode)
+		App.renderPage(logger, w, statuscode, "namespacecompare.html", page)
+		return
+	}
+	listA, err := App.keyList(logger, request.Namespace)
+	if err != nil {
+		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	if !App.authorize(logger, w, request, page.Other, RoleViewer, "Compare") {
+		return
+	}
+	listB, err := App.keyList(logger, page.Other)
+	if err != nil {
+		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	if request.Method == "POST" {
+		function := request.orgRequest.PostFormValue("input")
+		requests.WithLabelValues(request.Path, request.Method, function).Inc()
+		selected := request.orgRequest.PostForm["keys"]
+		switch function {
+		case "Copy to B":
+			if !App.authorize(logger, w, request, page.Other, RoleEditor, "Copy") {
+				return
+			}
+			page.Results = App.copyMissing(logger, listA, listB, page.Other, selected)
+			App.auditResults(request, "Copy", page.Other, page.Results)
+			listB, err = App.keyList(logger, page.Other)
+		case "Copy to A":
+			if !App.authorize(logger, w, request, request.Namespace, RoleEditor, "Copy") {
+				return
+			}
+			page.Results = App.copyMissing(logger, listB, listA, request.Namespace, selected)
+			App.auditResults(request, "Copy", request.Namespace, page.Results)
+			listA, err = App.keyList(logger, request.Namespace)
+		default:
+			debugLogger.Debug("Unknown post", "function", function)
+		}
+		if err != nil {
+			debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+			App.BadRequestHandler(logger, w, request)
+			return
+		}
+		logger.Info("Keys copied", "namespace", request.Namespace, "other", page.Other, "keys", len(page.Results))
+	} else {
+		requests.WithLabelValues(request.Path, request.Method, "Compare").Inc()
+	}
+	page.compare(App.FingerprintKey, listA, listB)
+	logger.Info("Namespace compare request", "status", statuscode)
+	App.renderPage(logger, w, statuscode, "namespacecompare.html", page)
+}
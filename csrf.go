@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	csrfCookieName  = "kvdbw_csrf"
+	csrfFormField   = "csrf_token"
+	csrfHeaderName  = "X-CSRF-Token"
+	csrfTokenLength = 32
+)
+
+type ConfigCSRF struct {
+	TrustedOrigins []string `mapstructure:"trustedOrigins"`
+}
+
+type ConfigCookies struct {
+	Secure   bool   `mapstructure:"secure"`
+	SameSite string `mapstructure:"sameSite"`
+}
+
+type CSRFError struct {
+	Reason string
+}
+
+func (e *CSRFError) Error() string {
+	return fmt.Sprintf("csrf check failed: %v", e.Reason)
+}
+
+func RandomToken(length int) string {
+	buffer := make([]byte, length)
+	rand.Read(buffer)
+	return hex.EncodeToString(buffer)
+}
+
+func (App *Application) cookieSameSite() http.SameSite {
+	switch strings.ToLower(App.Config.Cookies.SameSite) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteStrictMode
+	}
+}
+
+func (App *Application) newCookie(name string, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   App.Config.Cookies.Secure,
+		SameSite: App.cookieSameSite(),
+	}
+}
+
+// csrfToken returns the CSRF token bound to the browser session and issues a new one if none is present.
+func (App *Application) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	cookie, err := r.Cookie(csrfCookieName)
+	if err == nil && len(cookie.Value) == csrfTokenLength*2 {
+		if _, err := hex.DecodeString(cookie.Value); err == nil {
+			return cookie.Value
+		}
+	}
+	token := RandomToken(csrfTokenLength)
+	http.SetCookie(w, App.newCookie(csrfCookieName, token))
+	return token
+}
+
+func (App *Application) trustedOrigin(r *http.Request, origin string) bool {
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	if strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	if forwardedHost := r.Header.Get("X-Forwarded-Host"); forwardedHost != "" && strings.EqualFold(parsed.Host, forwardedHost) {
+		return true
+	}
+	for _, trusted := range App.Config.CSRF.TrustedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(trusted, "/"), parsed.Scheme+"://"+parsed.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyCSRF checks Origin/Referer and the submitted token against the cookie. The form must already be parsed.
+func (App *Application) verifyCSRF(request *RequestParameters) error {
+	r := request.orgRequest
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if !App.trustedOrigin(r, origin) {
+			return &CSRFError{Reason: "untrusted origin " + origin}
+		}
+	} else if referer := r.Header.Get("Referer"); referer != "" {
+		if !App.trustedOrigin(r, referer) {
+			return &CSRFError{Reason: "untrusted referer " + referer}
+		}
+	}
+	submitted := r.Header.Get(csrfHeaderName)
+	if submitted == "" {
+		submitted = r.PostFormValue(csrfFormField)
+	}
+	if submitted == "" || request.CSRFToken == "" {
+		return &CSRFError{Reason: "missing token"}
+	}
+	if subtle.ConstantTimeCompare([]byte(submitted), []byte(request.CSRFToken)) != 1 {
+		return &CSRFError{Reason: "token mismatch"}
+	}
+	return nil
+}
+
+// parsePost parses the posted form and verifies the CSRF token, writing an error response and returning false on failure.
+func (App *Application) parsePost(logger *slog.Logger, w http.ResponseWriter, request *RequestParameters) bool {
+	debugLogger := logger.With(slog.Any("function", "parsePost")).With(slog.Any("struct", "Application"))
+	err := request.orgRequest.ParseForm()
+	if err != nil {
+		debugLogger.Debug("ParseForm Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return false
+	}
+	err = App.verifyCSRF(request)
+	if err != nil {
+		debugLogger.Debug("CSRF Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.ForbiddenHandler(logger, w, request)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestVerifyCSRF(t *testing.T) {
+	App := new(Application)
+	App.Config.CSRF.TrustedOrigins = []string{"https://proxy.example.com/"}
+	token := RandomToken(csrfTokenLength)
+	tests := []struct {
+		name    string
+		form    url.Values
+		headers map[string]string
+		cookie  string
+		reason  string
+	}{
+		{name: "form token", form: url.Values{csrfFormField: {token}}, cookie: token},
+		{name: "header token", headers: map[string]string{csrfHeaderName: token}, cookie: token},
+		{name: "same origin", form: url.Values{csrfFormField: {token}}, headers: map[string]string{"Origin": "http://kvdbw.test"}, cookie: token},
+		{name: "trusted origin", form: url.Values{csrfFormField: {token}}, headers: map[string]string{"Origin": "https://proxy.example.com"}, cookie: token},
+		{name: "forwarded host", form: url.Values{csrfFormField: {token}}, headers: map[string]string{"Origin": "https://public.example.com", "X-Forwarded-Host": "public.example.com"}, cookie: token},
+		{name: "same referer", form: url.Values{csrfFormField: {token}}, headers: map[string]string{"Referer": "http://kvdbw.test/v1/app/"}, cookie: token},
+		{name: "untrusted origin", form: url.Values{csrfFormField: {token}}, headers: map[string]string{"Origin": "https://evil.example.com"}, cookie: token, reason: "untrusted origin"},
+		{name: "untrusted referer", form: url.Values{csrfFormField: {token}}, headers: map[string]string{"Referer": "https://evil.example.com/form"}, cookie: token, reason: "untrusted referer"},
+		{name: "opaque origin", form: url.Values{csrfFormField: {token}}, headers: map[string]string{"Origin": "null"}, cookie: token, reason: "untrusted origin"},
+		{name: "missing token", cookie: token, reason: "missing token"},
+		{name: "missing cookie", form: url.Values{csrfFormField: {token}}, reason: "missing token"},
+		{name: "token mismatch", form: url.Values{csrfFormField: {RandomToken(csrfTokenLength)}}, cookie: token, reason: "token mismatch"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "http://kvdbw.test/v1/app/", strings.NewReader(test.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			for name, value := range test.headers {
+				r.Header.Set(name, value)
+			}
+			if err := r.ParseForm(); err != nil {
+				t.Fatal(err)
+			}
+			request := GetRequestParameters(r)
+			request.CSRFToken = test.cookie
+			err := App.verifyCSRF(request)
+			if test.reason == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var csrfError *CSRFError
+			if !errors.As(err, &csrfError) || !strings.HasPrefix(csrfError.Reason, test.reason) {
+				t.Fatalf("expected %q, got %v", test.reason, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const expiryDateFormat = "2006-01-02"
+
+type ConfigExpiry struct {
+	Warning time.Duration `mapstructure:"warning"`
+	Refresh time.Duration `mapstructure:"refresh"`
+}
+
+var expirySecondsDesc = prometheus.NewDesc("kvdbw_key_expiry_seconds", "Seconds until the key expires, negative when it has expired", []string{"namespace", "key"}, nil)
+
+// ExpiryIndex keeps the expiry dates of all keys in memory so metrics and warnings do not read the backend.
+type ExpiryIndex struct {
+	mutex    sync.Mutex
+	expiries map[string]map[string]time.Time
+}
+
+func NewExpiryIndex() *ExpiryIndex {
+	return &ExpiryIndex{expiries: map[string]map[string]time.Time{}}
+}
+
+// Set replaces the expiry dates of a namespace from its metadata.
+func (e *ExpiryIndex) Set(namespace string, metadata map[string]KeyMetadata) {
+	expiries := map[string]time.Time{}
+	for key, entry := range metadata {
+		if !entry.Expires.IsZero() {
+			expiries[key] = entry.Expires
+		}
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if len(expiries) == 0 {
+		delete(e.expiries, namespace)
+	} else {
+		e.expiries[namespace] = expiries
+	}
+}
+
+// Replace sets the expiry dates of all namespaces.
+func (e *ExpiryIndex) Replace(all map[string]map[string]KeyMetadata) {
+	index := NewExpiryIndex()
+	for namespace, metadata := range all {
+		index.Set(namespace, metadata)
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.expiries = index.expiries
+}
+
+func (e *ExpiryIndex) Describe(ch chan<- *prometheus.Desc) {
+	ch <- expirySecondsDesc
+}
+
+func (e *ExpiryIndex) Collect(ch chan<- prometheus.Metric) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	now := time.Now()
+	for namespace, expiries := range e.expiries {
+		for key, expires := range expiries {
+			ch <- prometheus.MustNewConstMetric(expirySecondsDesc, prometheus.GaugeValue, expires.Sub(now).Seconds(), namespace, key)
+		}
+	}
+}
+
+// expiryState is "expired" or "soon" when the expiry is within expiry.warning, empty otherwise.
+func (App *Application) expiryState(expires time.Time, now time.Time) string {
+	switch {
+	case expires.IsZero():
+		return ""
+	case !expires.After(now):
+		return "expired"
+	case expires.Sub(now) <= App.Config.Expiry.Warning:
+		return "soon"
+	}
+	return ""
+}
+
+// parseExpiry reads a date from the metadata form, an empty date removes the expiry.
+func parseExpiry(input string) (time.Time, error) {
+	if input == "" {
+		return time.Time{}, nil
+	}
+	expires, err := time.Parse(expiryDateFormat, input)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expiry date must be YYYY-MM-DD")
+	}
+	return expires, nil
+}
+
+// loadAllMetadata returns the metadata of every namespace.
+func (App *Application) loadAllMetadata(logger *slog.Logger) (map[string]map[string]KeyMetadata, error) {
+	all := map[string]map[string]KeyMetadata{}
+	list, err := App.KVDBClient.GetKeyList(logger, App.Metadata.namespace)
+	var statusError *HTTPStatusError
+	if errors.As(err, &statusError) && statusError.StatusCode == http.StatusNotFound {
+		return all, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range list {
+		metadata := map[string]KeyMetadata{}
+		if err := json.Unmarshal([]byte(pair.Value), &metadata); err != nil {
+			logger.Warn("Metadata is not valid", "namespace", pair.Key, "error", err)
+			continue
+		}
+		all[pair.Key] = metadata
+	}
+	return all, nil
+}
+
+// refreshExpiry rebuilds the expiry index from the backend, it picks up changes made by other instances.
+func (App *Application) refreshExpiry(logger *slog.Logger) {
+	all, err := App.loadAllMetadata(logger)
+	if err != nil {
+		logger.Error("Expiry refresh failed", "error", err)
+		return
+	}
+	App.Expiry.Replace(all)
+}
+
+// StartExpiry refreshes the expiry index now and every expiry.refresh in the background.
+func (App *Application) StartExpiry() {
+	logger := App.Logger.With(slog.Any("function", "StartExpiry")).With(slog.Any("struct", "Application"))
+	go func() {
+		App.refreshExpiry(logger)
+		ticker := time.NewTicker(App.Config.Expiry.Refresh)
+		defer ticker.Stop()
+		for range ticker.C {
+			App.refreshExpiry(logger)
+		}
+	}()
+}
+
+type ExpiringKey struct {
+	Namespace string
+	Key       string
+	Expires   time.Time
+	Days      int
+	State     string
+}
+
+type ExpiringList struct {
+	Page
+	Days  int
+	Items []ExpiringKey
+}
+
+// ExpiringController lists the keys expiring within the given days across all namespaces the user can view.
+func (App *Application) ExpiringController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "ExpiringController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Expiring Request")
+	requests.WithLabelValues(request.Path, request.Method, "").Inc()
+	page := ExpiringList{Page: App.newPage(request), Days: int(App.Config.Expiry.Warning.Hours() / 24)}
+	page.Api = "v1"
+	if days, err := strconv.Atoi(request.orgRequest.URL.Query().Get("days")); err == nil && days >= 0 {
+		page.Days = days
+	}
+	all, err := App.loadAllMetadata(logger)
+	if err != nil {
+		debugLogger.Debug("Metadata Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	now := time.Now()
+	limit := now.Add(time.Duration(page.Days) * 24 * time.Hour)
+	for namespace, metadata := range all {
+		if !App.role(request.Identity, namespace).CanView() {
+			continue
+		}
+		for key, entry := range metadata {
+			if entry.Expires.IsZero() || entry.Expires.After(limit) || App.protection(namespace, key).Hidden {
+				continue
+			}
+			state := App.expiryState(entry.Expires, now)
+			if state == "" {
+				state = "ok"
+			}
+			page.Items = append(page.Items, ExpiringKey{Namespace: namespace, Key: key, Expires: entry.Expires, Days: int(entry.Expires.Sub(now).Hours() / 24), State: state})
+		}
+	}
+	slices.SortFunc(page.Items, func(a, b ExpiringKey) int { return a.Expires.Compare(b.Expires) })
+	logger.Info("Expiring request", "keys", len(page.Items), "status", http.StatusOK)
+	App.renderPage(logger, w, http.StatusOK, "expiring.html", page)
+}
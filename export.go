@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/SimonStiil/keyvaluedatabase/rest"
+	"go.yaml.in/yaml/v3"
+)
+
+type ExportFormat struct {
+	Name        string
+	Description string
+	ContentType string
+	FileName    string
+	Encode      func(namespace string, list []rest.KVPairV2) ([]byte, error)
+}
+
+var exportFormats = []ExportFormat{
+	{Name: "json", Description: "JSON", ContentType: "application/json", FileName: "%v.json", Encode: exportJSON},
+	{Name: "yaml", Description: "YAML", ContentType: "application/yaml", FileName: "%v.yaml", Encode: exportYAML},
+	{Name: "dotenv", Description: "dotenv", ContentType: "text/plain; charset=utf-8", FileName: "%v.env", Encode: exportDotenv},
+	{Name: "secret", Description: "Kubernetes Secret", ContentType: "application/yaml", FileName: "%v-secret.yaml", Encode: exportSecret},
+}
+
+type NamespaceExport struct {
+	Page
+	Namespace string
+	Formats   []ExportFormat
+	Keys      []CloneKey
+}
+
+func pairsToMap(list []rest.KVPairV2) map[string]string {
+	values := make(map[string]string, len(list))
+	for _, pair := range list {
+		values[pair.Key] = pair.Value
+	}
+	return values
+}
+
+func exportJSON(namespace string, list []rest.KVPairV2) ([]byte, error) {
+	return json.MarshalIndent(pairsToMap(list), "", "  ")
+}
+
+func exportYAML(namespace string, list []rest.KVPairV2) ([]byte, error) {
+	return yaml.Marshal(pairsToMap(list))
+}
+
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`)
+
+// exportDotenv writes every value double quoted with newlines escaped so multi-line values survive a round trip.
+func exportDotenv(namespace string, list []rest.KVPairV2) ([]byte, error) {
+	var buffer bytes.Buffer
+	for _, pair := range list {
+		fmt.Fprintf(&buffer, "%v=\"%v\"\n", pair.Key, dotenvEscaper.Replace(pair.Value))
+	}
+	return buffer.Bytes(), nil
+}
+
+type kubernetesSecret struct {
+	ApiVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   map[string]string `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       map[string]string `yaml:"data"`
+}
+
+var kubernetesNameInvalid = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+func exportSecret(namespace string, list []rest.KVPairV2) ([]byte, error) {
+	name := strings.Trim(kubernetesNameInvalid.ReplaceAllString(strings.ToLower(namespace), "-"), "-.")
+	secret := kubernetesSecret{ApiVersion: "v1", Kind: "Secret", Metadata: map[string]string{"name": name}, Type: "Opaque", Data: make(map[string]string, len(list))}
+	for _, pair := range list {
+		secret.Data[pair.Key] = base64.StdEncoding.EncodeToString([]byte(pair.Value))
+	}
+	return yaml.Marshal(secret)
+}
+
+// namespaceReadable reports if the backend grants read access to the namespace.
+func (App *Application) namespaceReadable(logger *slog.Logger, namespace string) (bool, error) {
+	namespaces, err := App.KVDBClient.GetNamespaceList(logger)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(namespaces, func(existing rest.NamespaceV2) bool { return existing.Name == namespace && existing.Access }), nil
+}
+
+// NamespaceExportController shows the export form and returns the selected keys as a download when a format is requested.
+func (App *Application) NamespaceExportController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "NamespaceExportController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Namespace Export Request")
+	query := request.orgRequest.URL.Query()
+	formatName := query.Get("format")
+	requests.WithLabelValues(request.Path, request.Method, formatName).Inc()
+	readable, err := App.namespaceReadable(logger, request.Namespace)
+	if err != nil {
+		debugLogger.Debug("GetNamespaceList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	if !readable {
+		App.ForbiddenHandler(logger, w, request)
+		return
+	}
+	kvlist, err := App.keyList(logger, request.Namespace)
+	if err != nil {
+		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	if formatName == "" {
+		page := NamespaceExport{Page: App.newPage(request), Namespace: request.Namespace, Formats: exportFormats}
+		selected, preselected := query["keys"]
+		for _, pair := range kvlist {
+			page.Keys = append(page.Keys, CloneKey{Key: pair.Key, Selected: !preselected || slices.Contains(selected, pair.Key)})
+		}
+		logger.Info("Namespace export request", "status", http.StatusOK)
+		App.renderPage(logger, w, http.StatusOK, "namespaceexport.html", page)
+		return
+	}
+	index := slices.IndexFunc(exportFormats, func(format ExportFormat) bool { return format.Name == formatName })
+	if index < 0 {
+		debugLogger.Debug("Unknown format", "format", formatName)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	format := exportFormats[index]
+	if selected, ok := query["keys"]; ok {
+		kvlist = slices.DeleteFunc(kvlist, func(pair rest.KVPairV2) bool { return !slices.Contains(selected, pair.Key) })
+	}
+	content, err := format.Encode(request.Namespace, kvlist)
+	if err != nil {
+		debugLogger.Debug("Encode Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.InternalServerErrorHandler(logger, w)
+		return
+	}
+	logger.Info("Namespace exported", "namespace", request.Namespace, "format", format.Name, "keys", len(kvlist), "status", http.StatusOK)
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf(format.FileName, request.Namespace)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/sethvargo/go-diceware/diceware"
+)
+
+// GeneratorBackend leaves generating the value to the backend's fixed 32 character random value.
+const GeneratorBackend = "backend"
+
+const ambiguousCharacters = "0Oo1lI|"
+
+var characterClasses = map[string]string{
+	"lower":   "abcdefghijklmnopqrstuvwxyz",
+	"upper":   "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"digits":  "0123456789",
+	"symbols": "!#$%&()*+,-./:;<=>?@[]^_{}~",
+}
+
+type ConfigGenerators struct {
+	Profiles []ConfigGeneratorProfile `mapstructure:"profiles"`
+	Defaults []ConfigGeneratorDefault `mapstructure:"defaults"`
+}
+
+// ConfigGeneratorProfile describes how a value is generated, Length counts characters for random, words for
+// passphrase and random bytes for hex and base64.
+type ConfigGeneratorProfile struct {
+	Name             string   `mapstructure:"name"`
+	Type             string   `mapstructure:"type"`
+	Length           int      `mapstructure:"length"`
+	Classes          []string `mapstructure:"classes"`
+	ExcludeAmbiguous bool     `mapstructure:"excludeAmbiguous"`
+	Separator        string   `mapstructure:"separator"`
+	WordList         string   `mapstructure:"wordList"`
+}
+
+// ConfigGeneratorDefault selects the profile preselected for namespaces matching Namespaces.
+type ConfigGeneratorDefault struct {
+	Namespaces []string `mapstructure:"namespaces"`
+	Profile    string   `mapstructure:"profile"`
+}
+
+type generatorProfile struct {
+	ConfigGeneratorProfile
+	alphabet string
+	words    []string
+}
+
+type Generators struct {
+	names    []string
+	profiles map[string]*generatorProfile
+	defaults []ConfigGeneratorDefault
+}
+
+// NewGenerators checks the profiles and reads their word lists so mistakes are found at start.
+func NewGenerators(config ConfigGenerators) (*Generators, error) {
+	generators := &Generators{names: []string{GeneratorBackend}, profiles: map[string]*generatorProfile{}, defaults: config.Defaults}
+	for _, profile := range config.Profiles {
+		if profile.Name == "" || slices.Contains(generators.names, profile.Name) {
+			return nil, fmt.Errorf("generator profile name %q is empty or used twice", profile.Name)
+		}
+		generator := &generatorProfile{ConfigGeneratorProfile: profile}
+		switch profile.Type {
+		case "random":
+			for _, class := range profile.Classes {
+				characters, ok := characterClasses[class]
+				if !ok {
+					return nil, fmt.Errorf("generator %v: unknown character class %v", profile.Name, class)
+				}
+				generator.alphabet += characters
+			}
+			if profile.ExcludeAmbiguous {
+				generator.alphabet = strings.Map(func(r rune) rune {
+					if strings.ContainsRune(ambiguousCharacters, r) {
+						return -1
+					}
+					return r
+				}, generator.alphabet)
+			}
+			if generator.alphabet == "" {
+				return nil, fmt.Errorf("generator %v: no character classes", profile.Name)
+			}
+		case "passphrase":
+			if profile.WordList != "" {
+				words, err := readWordList(profile.WordList)
+				if err != nil {
+					return nil, fmt.Errorf("generator %v: %w", profile.Name, err)
+				}
+				generator.words = words
+			}
+		case "uuid", "hex", "base64":
+		default:
+			return nil, fmt.Errorf("generator %v: unknown type %q", profile.Name, profile.Type)
+		}
+		if profile.Length <= 0 && profile.Type != "uuid" {
+			return nil, fmt.Errorf("generator %v: length must be positive", profile.Name)
+		}
+		generators.names = append(generators.names, profile.Name)
+		generators.profiles[profile.Name] = generator
+	}
+	for _, rule := range config.Defaults {
+		if !slices.Contains(generators.names, rule.Profile) {
+			return nil, fmt.Errorf("generator default for %v uses unknown profile %q", rule.Namespaces, rule.Profile)
+		}
+	}
+	return generators, nil
+}
+
+func readWordList(name string) ([]string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" && !strings.HasPrefix(word, "#") {
+			words = append(words, word)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) < 2 {
+		return nil, fmt.Errorf("word list %v has less than two words", name)
+	}
+	return words, nil
+}
+
+// Names lists the backend generator followed by the configured profiles.
+func (g *Generators) Names() []string {
+	return g.names
+}
+
+// Default returns the profile of the first default rule matching the namespace, the backend when none match.
+func (g *Generators) Default(namespace string) string {
+	for _, rule := range g.defaults {
+		if matchPatterns(rule.Namespaces, namespace) {
+			return rule.Profile
+		}
+	}
+	return GeneratorBackend
+}
+
+func randomIndex(n int) (int, error) {
+	index, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(index.Int64()), nil
+}
+
+func randomBytes(n int) ([]byte, error) {
+	data := make([]byte, n)
+	_, err := rand.Read(data)
+	return data, err
+}
+
+// Generate returns a new value from the profile, random values contain at least one character of every class.
+func (g *Generators) Generate(name string) (string, error) {
+	profile, ok := g.profiles[name]
+	if !ok {
+		return "", fmt.Errorf("unknown generator %q", name)
+	}
+	switch profile.Type {
+	case "random":
+		for {
+			value := make([]byte, profile.Length)
+			for i := range value {
+				index, err := randomIndex(len(profile.alphabet))
+				if err != nil {
+					return "", err
+				}
+				value[i] = profile.alphabet[index]
+			}
+			if profile.Length < len(profile.Classes) || profile.hasEveryClass(string(value)) {
+				return string(value), nil
+			}
+		}
+	case "passphrase":
+		var words []string
+		if profile.words == nil {
+			var err error
+			if words, err = diceware.Generate(profile.Length); err != nil {
+				return "", err
+			}
+		}
+		for len(words) < profile.Length {
+			index, err := randomIndex(len(profile.words))
+			if err != nil {
+				return "", err
+			}
+			words = append(words, profile.words[index])
+		}
+		return strings.Join(words, profile.Separator), nil
+	case "uuid":
+		data, err := randomBytes(16)
+		if err != nil {
+			return "", err
+		}
+		data[6] = data[6]&0x0f | 0x40
+		data[8] = data[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", data[0:4], data[4:6], data[6:8], data[8:10], data[10:]), nil
+	case "hex":
+		data, err := randomBytes(profile.Length)
+		return hex.EncodeToString(data), err
+	case "base64":
+		data, err := randomBytes(profile.Length)
+		return base64.RawURLEncoding.EncodeToString(data), err
+	}
+	return "", fmt.Errorf("unknown generator type %q", profile.Type)
+}
+
+func (profile *generatorProfile) hasEveryClass(value string) bool {
+	for _, class := range profile.Classes {
+		if !strings.ContainsAny(value, characterClasses[class]) {
+			return false
+		}
+	}
+	return true
+}
+
+// generateKey writes a generated value into the key, the backend generator uses the backend's Generate and Roll.
+// Rolling a key that does not exist fails with the HTTPStatusError of the backend.
+func (App *Application) generateKey(logger *slog.Logger, namespace string, key string, generator string, roll bool) error {
+	if generator == "" || generator == GeneratorBackend {
+		if roll {
+			return App.KVDBClient.Roll(logger, namespace, key)
+		}
+		return App.KVDBClient.Generate(logger, namespace, key)
+	}
+	if roll {
+		// Roll only replaces existing keys, like the backend Roll answering 404
+		if _, err := App.KVDBClient.GetKey(logger, namespace, key); err != nil {
+			return err
+		}
+	}
+	value, err := App.Generators.Generate(generator)
+	if err != nil {
+		return err
+	}
+	action := "Generate"
+	if roll {
+		action = "Roll"
+	}
+	return App.KVDBClient.SetKeyAs(logger, namespace, key, value, action)
+}
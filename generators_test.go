@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SimonStiil/keyvaluedatabase/rest"
+)
+
+// testBackend answers the key reads and writes of Client, values are stored under namespace/key.
+type testBackend struct {
+	mutex  sync.Mutex
+	values map[string]string
+}
+
+func (b *testBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch r.Method {
+	case "GET":
+		value, ok := b.values[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(rest.KVPairV2{Key: path.Base(name), Value: value})
+	case "POST":
+		var object rest.ObjectV1
+		if err := json.NewDecoder(r.Body).Decode(&object); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		b.values[name] = object.Value
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, "%v %v", http.StatusCreated, http.StatusText(http.StatusCreated))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (b *testBackend) value(name string) (string, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	value, ok := b.values[name]
+	return value, ok
+}
+
+func newTestBackend(t *testing.T, values map[string]string) (*testBackend, *Client) {
+	t.Helper()
+	backend := &testBackend{values: values}
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+	address, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend, &Client{BackendConfig: ConfigBackend{Host: address.Hostname(), Port: address.Port(), Protocol: "http"}}
+}
+
+func newGeneratorTestApp(t *testing.T, values map[string]string) (*Application, *testBackend) {
+	t.Helper()
+	App := new(Application)
+	App.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	generators, err := NewGenerators(ConfigGenerators{Profiles: []ConfigGeneratorProfile{{Name: "hex", Type: "hex", Length: 16}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	App.Generators = generators
+	backend, client := newTestBackend(t, values)
+	App.KVDBClient = client
+	return App, backend
+}
+
+func TestGenerateKeyRollWithProfile(t *testing.T) {
+	App, backend := newGeneratorTestApp(t, map[string]string{"app/db": "old"})
+	if err := App.generateKey(App.Logger, "app", "db", "hex", true); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := backend.value("app/db"); len(value) != 32 || value == "old" {
+		t.Fatalf("key not rolled, value %q", value)
+	}
+	err := App.generateKey(App.Logger, "app", "missing", "hex", true)
+	var statusError *HTTPStatusError
+	if !errors.As(err, &statusError) || statusError.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 rolling a missing key, got %v", err)
+	}
+	if _, ok := backend.value("app/missing"); ok {
+		t.Fatal("rolling a missing key created it")
+	}
+	if err := App.generateKey(App.Logger, "app", "new", "hex", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := backend.value("app/new"); !ok {
+		t.Fatal("generate did not create the key")
+	}
+}
+
+func TestGenerateKeyRollWithProfileNotifiesRoll(t *testing.T) {
+	App, _ := newGeneratorTestApp(t, map[string]string{"app/db": "old"})
+	received := make(chan CloudEvent, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event CloudEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		received <- event
+	}))
+	t.Cleanup(receiver.Close)
+	webhooks, err := NewWebhooks(ConfigWebhooks{Hooks: []ConfigWebhook{{Name: "test", URL: receiver.URL}}}, App.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhooks.Start()
+	App.KVDBClient.Changed = webhooks.Notify
+	if err := App.generateKey(App.Logger, "app", "db", "hex", true); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-received:
+		if event.Type != webhookTypePrefix+"key.rolled" || event.Subject != "app/db" {
+			t.Fatalf("expected key.rolled for app/db, got %v for %v", event.Type, event.Subject)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event delivered")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type ConfigAuth struct {
+	Mode           string   `mapstructure:"mode"`
+	UserHeader     string   `mapstructure:"userHeader"`
+	GroupsHeader   string   `mapstructure:"groupsHeader"`
+	TrustedProxies []string `mapstructure:"trustedProxies"`
+}
+
+// Identity is the user making a request as reported by the authentication in front of the interface.
+type Identity struct {
+	User   string
+	Groups []string
+}
+
+// trustedProxy reports if identity headers can be trusted from the remote address, all addresses are trusted when no proxies are configured.
+func (App *Application) trustedProxy(remoteAddr string) bool {
+	if len(App.Config.Auth.TrustedProxies) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	address, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	for _, trusted := range App.Config.Auth.TrustedProxies {
+		prefix, err := netip.ParsePrefix(trusted)
+		if err != nil {
+			if single, err := netip.ParseAddr(trusted); err == nil && single == address.Unmap() {
+				return true
+			}
+			continue
+		}
+		if prefix.Contains(address.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionAuth reports if the interface authenticates users itself instead of trusting an authentication proxy.
+func (App *Application) sessionAuth() bool {
+	return App.Config.Auth.Mode == "oidc" || App.Config.Auth.Mode == "local"
+}
+
+func (App *Application) identify(r *http.Request) Identity {
+	if App.sessionAuth() {
+		return App.sessionIdentity(r)
+	}
+	if !App.trustedProxy(r.RemoteAddr) {
+		return Identity{}
+	}
+	identity := Identity{User: strings.TrimSpace(r.Header.Get(App.Config.Auth.UserHeader))}
+	if App.Config.Auth.GroupsHeader != "" {
+		for _, group := range strings.Split(r.Header.Get(App.Config.Auth.GroupsHeader), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				identity.Groups = append(identity.Groups, group)
+			}
+		}
+	}
+	return identity
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	importMaxSize        = 1 << 20
+	importPreviewMaxAge  = 10 * time.Minute
+	importPreviewMaxKept = 100
+)
+
+type ImportChange struct {
+	Key    string
+	Action string
+	Before string
+	After  string
+}
+
+type NamespaceImport struct {
+	Page
+	Namespace string
+	Format    string
+	Policy    string
+	Token     string
+	Changes   []ImportChange
+	Results   []KeyResult
+	Error     string
+}
+
+var importPolicies = []string{"skip", "overwrite", "fail"}
+
+type pendingImport struct {
+	Namespace string
+	User      string
+	Format    string
+	Values    map[string]string
+	Expires   time.Time
+}
+
+// ImportStore keeps parsed imports between preview and apply so the imported values are never sent to the browser.
+type ImportStore struct {
+	mutex   sync.Mutex
+	pending map[string]*pendingImport
+}
+
+func NewImportStore() *ImportStore {
+	return &ImportStore{pending: map[string]*pendingImport{}}
+}
+
+// Put keeps an import for importPreviewMaxAge and returns its token, the oldest import is dropped when too many are kept.
+func (s *ImportStore) Put(entry pendingImport) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	oldest := ""
+	for token, pending := range s.pending {
+		if now.After(pending.Expires) {
+			delete(s.pending, token)
+		} else if oldest == "" || pending.Expires.Before(s.pending[oldest].Expires) {
+			oldest = token
+		}
+	}
+	if len(s.pending) >= importPreviewMaxKept {
+		delete(s.pending, oldest)
+	}
+	token := RandomToken(16)
+	entry.Expires = now.Add(importPreviewMaxAge)
+	s.pending[token] = &entry
+	return token
+}
+
+// Take removes and returns an import, it is only returned to the user that previewed it for the same namespace.
+func (s *ImportStore) Take(token string, namespace string, user string) (pendingImport, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pending, ok := s.pending[token]
+	if !ok || pending.Namespace != namespace || pending.User != user {
+		return pendingImport{}, false
+	}
+	delete(s.pending, token)
+	if time.Now().After(pending.Expires) {
+		return pendingImport{}, false
+	}
+	return *pending, true
+}
+
+var dotenvLine = regexp.MustCompile(`^\s*(?:export\s+)?([A-Za-z_][A-Za-z0-9_.-]*)\s*=\s*(.*)$`)
+
+// importValue converts a decoded JSON or YAML value into the string stored in the backend.
+func importValue(value any) (string, error) {
+	switch typed := value.(type) {
+	case string:
+		return typed, nil
+	case nil:
+		return "", nil
+	case map[string]any, []any:
+		content, err := json.Marshal(typed)
+		return string(content), err
+	default:
+		return fmt.Sprint(typed), nil
+	}
+}
+
+func importDecoded(decoded map[string]any) (map[string]string, error) {
+	values := make(map[string]string, len(decoded))
+	for key, value := range decoded {
+		converted, err := importValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("key %v: %w", key, err)
+		}
+		values[key] = converted
+	}
+	return values, nil
+}
+
+func parseJSONImport(content []byte) (map[string]string, error) {
+	var decoded map[string]any
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		return nil, err
+	}
+	return importDecoded(decoded)
+}
+
+func parseYAMLImport(content []byte) (map[string]string, error) {
+	var decoded map[string]any
+	if err := yaml.Unmarshal(content, &decoded); err != nil {
+		return nil, err
+	}
+	return importDecoded(decoded)
+}
+
+var dotenvUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n", `\r`, "\r", `\$`, "$")
+
+// parseDotenvImport reads KEY=value lines, double quoted values may span lines and use the escapes written by exportDotenv.
+func parseDotenvImport(content []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), importMaxSize)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		match := dotenvLine.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("line %v: expected KEY=value", lineNumber)
+		}
+		key, value := match[1], strings.TrimSpace(match[2])
+		switch {
+		case strings.HasPrefix(value, `"`):
+			quoted := value[1:]
+			for !dotenvClosed(quoted) {
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("line %v: unterminated quote", lineNumber)
+				}
+				lineNumber++
+				quoted += "\n" + scanner.Text()
+			}
+			end := dotenvClosingQuote(quoted)
+			value = dotenvUnescaper.Replace(quoted[:end])
+		case strings.HasPrefix(value, `'`):
+			end := strings.Index(value[1:], `'`)
+			if end < 0 {
+				return nil, fmt.Errorf("line %v: unterminated quote", lineNumber)
+			}
+			value = value[1 : end+1]
+		default:
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = strings.TrimSpace(value[:comment])
+			}
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+func dotenvClosingQuote(quoted string) int {
+	escaped := false
+	for i, c := range quoted {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func dotenvClosed(quoted string) bool {
+	return dotenvClosingQuote(quoted) >= 0
+}
+
+// detectImportFormat guesses the format from the file name and falls back to looking at the content.
+func detectImportFormat(fileName string, content []byte) string {
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".env":
+		return "dotenv"
+	}
+	trimmed := bytes.TrimSpace(content)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return "json"
+	}
+	if _, err := parseDotenvImport(content); err == nil {
+		return "dotenv"
+	}
+	return "yaml"
+}
+
+func parseImport(format string, content []byte) (map[string]string, error) {
+	switch format {
+	case "json":
+		return parseJSONImport(content)
+	case "yaml":
+		return parseYAMLImport(content)
+	case "dotenv":
+		return parseDotenvImport(content)
+	}
+	return nil, fmt.Errorf("unknown format %v", format)
+}
+
+// planImport compares the imported values with the namespace, the changes are sorted by key.
+func planImport(fingerprintKey []byte, current map[string]string, imported map[string]string) []ImportChange {
+	var changes []ImportChange
+	for key, value := range imported {
+		change := ImportChange{Key: key, After: MaskValue(fingerprintKey, value)}
+		existing, exists := current[key]
+		switch {
+		case !exists:
+			change.Action = "Create"
+		case existing == value:
+			change.Action = "Unchanged"
+			change.Before = change.After
+		default:
+			change.Action = "Change"
+			change.Before = MaskValue(fingerprintKey, existing)
+		}
+		changes = append(changes, change)
+	}
+	slices.SortFunc(changes, func(a, b ImportChange) int { return strings.Compare(a.Key, b.Key) })
+	return changes
+}
+
+func (App *Application) applyImport(logger *slog.Logger, namespace string, policy string, changes []ImportChange, imported map[string]string) ([]KeyResult, error) {
+	if policy == "fail" && slices.ContainsFunc(changes, func(change ImportChange) bool { return change.Action == "Change" }) {
+		return nil, errors.New("existing keys would be changed and the conflict policy is fail, nothing was imported")
+	}
+	var results []KeyResult
+	App.batchMetadata(logger, namespace, func() {
+		for _, change := range changes {
+			result := KeyResult{Key: change.Key}
+			switch {
+			case change.Action == "Unchanged":
+				result.Result = "Unchanged"
+			case change.Action == "Change" && policy == "skip":
+				result.Result = "Skipped"
+			case !App.keyWritable(namespace, change.Key):
+				result = protectedKeyResult(change.Key)
+			case App.validateKeyValue(namespace, change.Key, imported[change.Key]) != nil:
+				result.Result = "Failed"
+				result.Error = "not a valid " + strings.ToUpper(App.markedFormat(namespace, change.Key)) + " document"
+			default:
+				err := App.KVDBClient.SetKey(logger, namespace, change.Key, imported[change.Key])
+				result.Result = map[string]string{"Create": "Created", "Change": "Updated"}[change.Action]
+				if err != nil {
+					result.Result = "Failed"
+					result.Error = err.Error()
+				}
+			}
+			results = append(results, result)
+		}
+	})
+	return results, nil
+}
+
+func (App *Application) readImportUpload(request *RequestParameters, format string) (map[string]string, string, error) {
+	file, header, err := request.orgRequest.FormFile("file")
+	if err != nil {
+		return nil, format, errors.New("no file uploaded")
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, format, err
+	}
+	if format == "" || format == "auto" {
+		format = detectImportFormat(header.Filename, content)
+	}
+	values, err := parseImport(format, content)
+	return values, format, err
+}
+
+// NamespaceImportController uploads a file, previews the resulting changes and applies them after confirmation.
+// The parsed values are kept in App.Imports between preview and apply, the form only carries their token.
+func (App *Application) NamespaceImportController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "NamespaceImportController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Namespace Import Request")
+	statuscode := http.StatusOK
+	page := NamespaceImport{Page: App.newPage(request), Namespace: request.Namespace, Policy: "skip"}
+	if request.Method != "POST" {
+		requests.WithLabelValues(request.Path, request.Method, "").Inc()
+		logger.Info("Namespace import request", "status", statuscode)
+		App.renderPage(logger, w, statuscode, "namespaceimport.html", page)
+		return
+	}
+	request.orgRequest.Body = http.MaxBytesReader(w, request.orgRequest.Body, importMaxSize)
+	if strings.HasPrefix(request.orgRequest.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := request.orgRequest.ParseMultipartForm(importMaxSize); err != nil {
+			debugLogger.Debug("ParseMultipartForm Error", "type", fmt.Sprintf("%t", err), "error", err)
+			App.BadRequestHandler(logger, w, request)
+			return
+		}
+	}
+	if !App.parsePost(logger, w, request) {
+		return
+	}
+	function := request.orgRequest.PostFormValue("input")
+	requests.WithLabelValues(request.Path, request.Method, function).Inc()
+	if !App.authorize(logger, w, request, request.Namespace, RoleEditor, "Import") {
+		return
+	}
+	page.Format = request.orgRequest.PostFormValue("format")
+	if policy := request.orgRequest.PostFormValue("policy"); slices.Contains(importPolicies, policy) {
+		page.Policy = policy
+	}
+	var imported map[string]string
+	var err error
+	switch function {
+	case "Preview":
+		imported, page.Format, err = App.readImportUpload(request, page.Format)
+	case "Apply":
+		pending, ok := App.Imports.Take(request.orgRequest.PostFormValue("token"), request.Namespace, request.Identity.User)
+		if !ok {
+			err = errors.New("the preview has expired or was already applied, upload the file again")
+		}
+		imported, page.Format = pending.Values, pending.Format
+	default:
+		err = fmt.Errorf("unknown action %v", function)
+	}
+	if err != nil {
+		debugLogger.Debug("Import Error", "type", fmt.Sprintf("%t", err), "error", err)
+		page.Error = fmt.Sprintf("Reading import failed: %v", err)
+		logger.Info("Namespace import request", "status", http.StatusBadRequest)
+		App.renderPage(logger, w, http.StatusBadRequest, "namespaceimport.html", page)
+		return
+	}
+	kvlist, err := App.keyList(logger, request.Namespace)
+	if err != nil {
+		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	page.Changes = planImport(App.FingerprintKey, pairsToMap(kvlist), imported)
+	if function == "Apply" {
+		page.Results, err = App.applyImport(logger, request.Namespace, page.Policy, page.Changes, imported)
+		if err != nil {
+			statuscode = http.StatusConflict
+			page.Error = err.Error()
+			App.audit(request, "Import", request.Namespace, "", err)
+		}
+		App.auditResults(request, "Import", request.Namespace, page.Results)
+		page.Changes = nil
+		logger.Info("Namespace imported", "namespace", request.Namespace, "policy", page.Policy, "keys", len(page.Results))
+	} else {
+		page.Token = App.Imports.Put(pendingImport{Namespace: request.Namespace, User: request.Identity.User, Format: page.Format, Values: imported})
+	}
+	logger.Info("Namespace import request", "status", statuscode)
+	App.renderPage(logger, w, statuscode, "namespaceimport.html", page)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SimonStiil/keyvaluedatabase/rest"
+)
+
+func TestParseDotenvImport(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		values  map[string]string
+		err     string
+	}{
+		{name: "plain", content: "A=1\nB = two words\n", values: map[string]string{"A": "1", "B": "two words"}},
+		{name: "comments and blank lines", content: "# header\n\nA=1 # trailing\nB=x#y\n", values: map[string]string{"A": "1", "B": "x#y"}},
+		{name: "export prefix", content: "export A=1\n", values: map[string]string{"A": "1"}},
+		{name: "single quoted", content: `A='no \n escapes'` + "\n", values: map[string]string{"A": `no \n escapes`}},
+		{name: "double quoted escapes", content: `A="line1\nline2 \"q\" \$HOME \\"` + "\n", values: map[string]string{"A": "line1\nline2 \"q\" $HOME \\"}},
+		{name: "double quoted multi-line", content: "A=\"line1\nline2\"\nB=2\n", values: map[string]string{"A": "line1\nline2", "B": "2"}},
+		{name: "empty value", content: "A=\nB=\"\"\n", values: map[string]string{"A": "", "B": ""}},
+		{name: "missing equals", content: "A=1\nnot a pair\n", err: "line 2: expected KEY=value"},
+		{name: "unterminated double quote", content: "A=\"open\nB=2\n", err: "unterminated quote"},
+		{name: "unterminated single quote", content: "A='open\n", err: "line 1: unterminated quote"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := parseDotenvImport([]byte(test.content))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(values, test.values) {
+				t.Fatalf("expected %q, got %q", test.values, values)
+			}
+		})
+	}
+}
+
+func TestDotenvRoundTrip(t *testing.T) {
+	list := []rest.KVPairV2{{Key: "A", Value: "multi\nline\r\nvalue"}, {Key: "B", Value: `quote " backslash \ dollar $X`}, {Key: "C", Value: "# not a comment"}}
+	content, err := exportDotenv("app", list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := parseDotenvImport(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pair := range list {
+		if values[pair.Key] != pair.Value {
+			t.Fatalf("%v: expected %q, got %q", pair.Key, pair.Value, values[pair.Key])
+		}
+	}
+}
+
+func TestImportStore(t *testing.T) {
+	store := NewImportStore()
+	values := map[string]string{"A": "secret"}
+	token := store.Put(pendingImport{Namespace: "app", User: "alice", Format: "dotenv", Values: values})
+	if _, ok := store.Take(token, "other", "alice"); ok {
+		t.Fatal("import returned for another namespace")
+	}
+	if _, ok := store.Take(token, "app", "bob"); ok {
+		t.Fatal("import returned to another user")
+	}
+	pending, ok := store.Take(token, "app", "alice")
+	if !ok || pending.Format != "dotenv" || !reflect.DeepEqual(pending.Values, values) {
+		t.Fatalf("unexpected import %+v", pending)
+	}
+	if _, ok := store.Take(token, "app", "alice"); ok {
+		t.Fatal("import applied twice")
+	}
+	expired := store.Put(pendingImport{Namespace: "app"})
+	store.pending[expired].Expires = time.Now().Add(-time.Second)
+	if _, ok := store.Take(expired, "app", ""); ok {
+		t.Fatal("expired import returned")
+	}
+	first := store.Put(pendingImport{Namespace: "app"})
+	for range importPreviewMaxKept {
+		store.Put(pendingImport{Namespace: "app"})
+	}
+	if len(store.pending) != importPreviewMaxKept {
+		t.Fatalf("expected %v kept imports, got %v", importPreviewMaxKept, len(store.pending))
+	}
+	if _, ok := store.Take(first, "app", ""); ok {
+		t.Fatal("oldest import was not dropped")
+	}
+}
@@ -20,6 +20,8 @@ type Client struct {
 	BackendConfig ConfigBackend
 	Password      string
 	TLSCpnfig     *tls.Config
+	// Changed is called after every successful change with the backend operation, key is empty for namespaces.
+	Changed func(action string, namespace string, key string)
 }
 
 func InitClient(config ConfigBackend) *Client {
@@ -55,6 +57,12 @@ func (e *HTTPStatusError) Error() string {
 	return fmt.Sprintf("%v %v", e.StatusCode, e.Status)
 }
 
+func (c *Client) changed(action string, namespace string, key string) {
+	if c.Changed != nil {
+		c.Changed(action, namespace, key)
+	}
+}
+
 func (c *Client) generatedBodyFromStatus(status int) string {
 	return fmt.Sprintf("%v %v", status, http.StatusText(status))
 }
@@ -112,7 +120,35 @@ func (c *Client) GetKeyList(logger *slog.Logger, namespace string) ([]rest.KVPai
 	}
 	return list, nil
 }
+func (c *Client) GetKey(logger *slog.Logger, namespace string, key string) (*rest.KVPairV2, error) {
+	debugLogger := logger.With("function", "GetKey", "struct", "Client", "namespace", namespace)
+	debugLogger.Debug("Get Key")
+	transport := &http.Transport{TLSClientConfig: c.TLSCpnfig}
+	client := &http.Client{Transport: transport}
+	req, _ := http.NewRequest("GET", fmt.Sprintf("%v://%v:%v/v1/%v/%v", c.BackendConfig.Protocol, c.BackendConfig.Host, c.BackendConfig.Port, namespace, key), nil)
+	req.SetBasicAuth(c.BackendConfig.Username, c.Password)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		debugLogger.Debug("Wrong status on request", "statuscode", resp.StatusCode, "response", resp)
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	var pair rest.KVPairV2
+	if err := json.NewDecoder(resp.Body).Decode(&pair); err != nil {
+		debugLogger.Debug("Json decoder error", "response", resp, "error", err)
+		return nil, err
+	}
+	return &pair, nil
+}
 func (c *Client) SetKey(logger *slog.Logger, namespace string, key string, value string) error {
+	return c.SetKeyAs(logger, namespace, key, value, "SetKey")
+}
+
+// SetKeyAs sets the value and reports the change as action, for values generated here for a Roll or Generate.
+func (c *Client) SetKeyAs(logger *slog.Logger, namespace string, key string, value string, action string) error {
 	debugLogger := logger.With("function", "SetKey", "struct", "Client", "namespace", namespace)
 	debugLogger.Debug("Set Key")
 	transport := &http.Transport{TLSClientConfig: c.TLSCpnfig}
@@ -139,6 +175,7 @@ func (c *Client) SetKey(logger *slog.Logger, namespace string, key string, value
 		debugLogger.Debug("ReadAll error", "response", resp, "error", err)
 	}
 	if strings.TrimSpace(string(bodyText)) == c.generatedBodyFromStatus(http.StatusCreated) {
+		c.changed(action, namespace, key)
 		return nil
 	}
 	debugLogger.Debug("Content Error", "bodyText", bodyText)
@@ -171,6 +208,7 @@ func (c *Client) CreateNamespace(logger *slog.Logger, namespace string) error {
 		debugLogger.Debug("ReadAll error", "response", resp, "error", err)
 	}
 	if string(bodyText) == c.generatedBodyFromStatus(http.StatusCreated) {
+		c.changed("CreateNamespace", namespace, "")
 		return nil
 	}
 	debugLogger.Debug("Content Error", "bodyText", bodyText)
@@ -196,6 +234,7 @@ func (c *Client) DeleteNamespace(logger *slog.Logger, namespace string) error {
 		debugLogger.Debug("ReadAll error", "response", resp, "error", err)
 	}
 	if strings.TrimSpace(string(bodyText)) == c.generatedBodyFromStatus(http.StatusOK) {
+		c.changed("DeleteNamespace", namespace, "")
 		return nil
 	}
 	debugLogger.Debug("Content Error", "bodyText", bodyText)
@@ -221,6 +260,7 @@ func (c *Client) DeleteKey(logger *slog.Logger, namespace string, key string) er
 		debugLogger.Debug("ReadAll error", "response", resp, "error", err)
 	}
 	if strings.TrimSpace(string(bodyText)) == c.generatedBodyFromStatus(http.StatusOK) {
+		c.changed("DeleteKey", namespace, key)
 		return nil
 	}
 	debugLogger.Debug("Content Error", "bodyText", bodyText)
@@ -258,6 +298,7 @@ func (c *Client) Roll(logger *slog.Logger, namespace string, key string) error {
 		debugLogger.Debug("Json decoder error", "response", resp, "body", bodyText, "error", err)
 	}
 	if key == pair.Key {
+		c.changed("Roll", namespace, key)
 		return nil
 	}
 	debugLogger.Debug("Content Error", "pair", pair)
@@ -297,6 +338,7 @@ func (c *Client) Generate(logger *slog.Logger, namespace string, key string) err
 		debugLogger.Debug("Json decoder error", "response", resp, "body", string(bodyBytes), "error", err)
 	}
 	if key == "" || key == pair.Key {
+		c.changed("Generate", namespace, pair.Key)
 		return nil
 	}
 	debugLogger.Debug("Content Error", "pair", pair)
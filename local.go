@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ConfigLocal struct {
+	UsersFile   string        `mapstructure:"usersFile"`
+	MaxAttempts int           `mapstructure:"maxAttempts"`
+	Lockout     time.Duration `mapstructure:"lockout"`
+}
+
+// LocalUser is a line of the users file, user:bcrypt-hash with an optional :group1,group2 suffix.
+type LocalUser struct {
+	Hash   []byte
+	Groups []string
+}
+
+var ErrLoginFailed = errors.New("invalid user or password")
+var ErrLoginLocked = errors.New("too many failed attempts")
+
+// LoadLocalUsers reads a htpasswd style file, only bcrypt hashes are accepted.
+func LoadLocalUsers(name string) (map[string]LocalUser, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	users := map[string]LocalUser{}
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, ":", 3)
+		if len(fields) < 2 || fields[0] == "" {
+			return nil, fmt.Errorf("%v line %v: expected user:hash", name, line)
+		}
+		if _, err := bcrypt.Cost([]byte(fields[1])); err != nil {
+			return nil, fmt.Errorf("%v line %v: %w", name, line, err)
+		}
+		user := LocalUser{Hash: []byte(fields[1])}
+		if len(fields) == 3 {
+			for _, group := range strings.Split(fields[2], ",") {
+				if group = strings.TrimSpace(group); group != "" {
+					user.Groups = append(user.Groups, group)
+				}
+			}
+		}
+		users[fields[0]] = user
+	}
+	return users, scanner.Err()
+}
+
+type loginAttempts struct {
+	Failures int
+	Until    time.Time
+}
+
+// LoginLimiter counts failed logins per key, a key is locked once it reaches the limit until the lockout has passed.
+type LoginLimiter struct {
+	mutex    sync.Mutex
+	attempts map[string]*loginAttempts
+	lockout  time.Duration
+}
+
+func NewLoginLimiter(lockout time.Duration) *LoginLimiter {
+	return &LoginLimiter{attempts: map[string]*loginAttempts{}, lockout: lockout}
+}
+
+func (l *LoginLimiter) Locked(key string, limit int) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	attempts, ok := l.attempts[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(attempts.Until) {
+		delete(l.attempts, key)
+		return false
+	}
+	return attempts.Failures >= limit
+}
+
+// Failure records a failed attempt, failures are forgotten when no new failure happens within the lockout.
+func (l *LoginLimiter) Failure(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	if len(l.attempts) > 10000 {
+		for other, attempts := range l.attempts {
+			if now.After(attempts.Until) {
+				delete(l.attempts, other)
+			}
+		}
+	}
+	attempts, ok := l.attempts[key]
+	if !ok || now.After(attempts.Until) {
+		attempts = &loginAttempts{}
+		l.attempts[key] = attempts
+	}
+	attempts.Failures++
+	attempts.Until = now.Add(l.lockout)
+}
+
+func (l *LoginLimiter) Reset(key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.attempts, key)
+}
+
+type LocalAuth struct {
+	config  ConfigLocal
+	limiter *LoginLimiter
+	dummy   []byte
+}
+
+// NewLocalAuth checks that the users file can be read, it is read again on every login so changes apply without a restart.
+func NewLocalAuth(config ConfigLocal) (*LocalAuth, error) {
+	if _, err := LoadLocalUsers(config.UsersFile); err != nil {
+		return nil, err
+	}
+	dummy, err := bcrypt.GenerateFromPassword([]byte(RandomToken(16)), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalAuth{config: config, limiter: NewLoginLimiter(config.Lockout), dummy: dummy}, nil
+}
+
+// Authenticate compares against a dummy hash for unknown users so response times do not reveal which users exist.
+func (l *LocalAuth) Authenticate(user string, password string) (Identity, error) {
+	users, err := LoadLocalUsers(l.config.UsersFile)
+	if err != nil {
+		return Identity{}, err
+	}
+	local, ok := users[user]
+	hash := local.Hash
+	if !ok {
+		hash = l.dummy
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !ok {
+		return Identity{}, ErrLoginFailed
+	}
+	return Identity{User: user, Groups: local.Groups}, nil
+}
+
+// clientIP uses the last X-Forwarded-For address when the request comes from a configured trusted proxy.
+func (App *Application) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if len(App.Config.Auth.TrustedProxies) > 0 && App.trustedProxy(r.RemoteAddr) {
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		if last := strings.TrimSpace(forwarded[len(forwarded)-1]); last != "" {
+			return last
+		}
+	}
+	return host
+}
+
+type Login struct {
+	Page
+	Username string
+	Next     string
+	Error    string
+}
+
+// LocalLogin shows the login form and starts a session for valid credentials, each user and each client address is
+// locked out after local.maxAttempts failures, client addresses are allowed three times as many to cover shared addresses.
+func (App *Application) LocalLogin(w http.ResponseWriter, request *RequestParameters, logger *slog.Logger) {
+	r := request.orgRequest
+	page := Login{Page: App.newPage(request), Next: localRedirect(r.URL.Query().Get("next"))}
+	if request.Method != "POST" {
+		App.renderPage(logger, w, http.StatusOK, "login.html", page)
+		return
+	}
+	if !App.parsePost(logger, w, request) {
+		return
+	}
+	page.Username = strings.TrimSpace(r.PostForm.Get("username"))
+	page.Next = localRedirect(r.PostForm.Get("next"))
+	request.Identity = Identity{User: page.Username}
+	userKey, ipKey := "user:"+page.Username, "ip:"+App.clientIP(r)
+	maxAttempts := App.Config.Local.MaxAttempts
+	if App.Local.limiter.Locked(userKey, maxAttempts) || App.Local.limiter.Locked(ipKey, maxAttempts*3) {
+		logger.Info("Login locked out", "user", page.Username)
+		App.auditDenied(request, "Login", "", "", ErrLoginLocked.Error())
+		page.Error = "Too many failed attempts, try again later."
+		App.renderPage(logger, w, http.StatusTooManyRequests, "login.html", page)
+		return
+	}
+	identity, err := App.Local.Authenticate(page.Username, r.PostForm.Get("password"))
+	App.audit(request, "Login", "", "", err)
+	if err != nil {
+		if !errors.Is(err, ErrLoginFailed) {
+			logger.Error("Users file unreadable", "file", App.Config.Local.UsersFile, "error", err)
+			App.InternalServerErrorHandler(logger, w)
+			return
+		}
+		logger.Info("Login failed", "user", page.Username)
+		App.Local.limiter.Failure(userKey)
+		App.Local.limiter.Failure(ipKey)
+		page.Error = "Invalid user or password."
+		App.renderPage(logger, w, http.StatusUnauthorized, "login.html", page)
+		return
+	}
+	App.Local.limiter.Reset(userKey)
+	if err := App.startSession(w, identity); err != nil {
+		App.InternalServerErrorHandler(logger, w)
+		return
+	}
+	logger.Info("Local login", "user", identity.User)
+	http.Redirect(w, r, page.Next, http.StatusSeeOther)
+}
+
+func (App *Application) LocalLogout(w http.ResponseWriter, request *RequestParameters, logger *slog.Logger) {
+	App.clearCookie(w, sessionCookieName)
+	App.audit(request, "Logout", "", "", nil)
+	logger.Info("Local logout", "user", request.Identity.User)
+	http.Redirect(w, request.orgRequest, "/auth/login", http.StatusSeeOther)
+}
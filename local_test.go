@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginLimiter(t *testing.T) {
+	limiter := NewLoginLimiter(time.Hour)
+	for range 2 {
+		limiter.Failure("user:alice")
+	}
+	if limiter.Locked("user:alice", 3) {
+		t.Fatal("locked before reaching the limit")
+	}
+	limiter.Failure("user:alice")
+	if !limiter.Locked("user:alice", 3) {
+		t.Fatal("not locked at the limit")
+	}
+	if limiter.Locked("user:bob", 3) {
+		t.Fatal("lockout applied to another key")
+	}
+	limiter.Reset("user:alice")
+	if limiter.Locked("user:alice", 3) {
+		t.Fatal("still locked after reset")
+	}
+}
+
+func TestLoginLimiterExpires(t *testing.T) {
+	limiter := NewLoginLimiter(20 * time.Millisecond)
+	limiter.Failure("ip:192.0.2.1")
+	if !limiter.Locked("ip:192.0.2.1", 1) {
+		t.Fatal("not locked at the limit")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if limiter.Locked("ip:192.0.2.1", 1) {
+		t.Fatal("still locked after the lockout")
+	}
+	limiter.Failure("ip:192.0.2.1")
+	limiter.Failure("ip:192.0.2.1")
+	if !limiter.Locked("ip:192.0.2.1", 2) {
+		t.Fatal("failures from before the lockout were not forgotten")
+	}
+}
+
+func writeUsersFile(t *testing.T, content string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "users")
+	if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestLocalAuthAuthenticate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := writeUsersFile(t, "# users\nalice:"+string(hash)+":ops, dev\nbob:"+string(hash)+"\n")
+	local, err := NewLocalAuth(ConfigLocal{UsersFile: name, MaxAttempts: 3, Lockout: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := local.Authenticate("alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.User != "alice" || !reflect.DeepEqual(identity.Groups, []string{"ops", "dev"}) {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+	if identity, err = local.Authenticate("bob", "secret"); err != nil || identity.Groups != nil {
+		t.Fatalf("unexpected identity %+v: %v", identity, err)
+	}
+	for _, test := range []struct{ user, password string }{{"alice", "wrong"}, {"carol", "secret"}, {"", ""}} {
+		if _, err := local.Authenticate(test.user, test.password); !errors.Is(err, ErrLoginFailed) {
+			t.Fatalf("%v/%v: expected ErrLoginFailed, got %v", test.user, test.password, err)
+		}
+	}
+}
+
+func TestLoadLocalUsersRejectsPlainPasswords(t *testing.T) {
+	if _, err := NewLocalAuth(ConfigLocal{UsersFile: writeUsersFile(t, "alice:secret\n")}); err == nil {
+		t.Fatal("plain text password accepted")
+	}
+	if _, err := NewLocalAuth(ConfigLocal{UsersFile: writeUsersFile(t, "alice\n")}); err == nil {
+		t.Fatal("line without hash accepted")
+	}
+}
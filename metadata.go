@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ConfigMetadata struct {
+	Namespace string `mapstructure:"namespace"`
+}
+
+// KeyMetadata is kept by the web tier as the backend only stores values.
+type KeyMetadata struct {
+	Description string    `json:"description,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	Created     time.Time `json:"created,omitzero"`
+	Updated     time.Time `json:"updated,omitzero"`
+	Seen        time.Time `json:"seen,omitzero"`
+	Expires     time.Time `json:"expires,omitzero"`
+}
+
+// MetadataStore keeps the metadata of each namespace as one JSON document in the metadata namespace, keyed by
+// namespace name. Updates are serialised so concurrent requests do not lose changes.
+type MetadataStore struct {
+	mutex     sync.Mutex
+	namespace string
+	created   bool
+	// batches counts the running batches per namespace, their changes wait in pending until the last one ends.
+	batchMutex sync.Mutex
+	batches    map[string]int
+	pending    map[string][]func(metadata map[string]KeyMetadata)
+}
+
+func NewMetadataStore(config ConfigMetadata) *MetadataStore {
+	return &MetadataStore{namespace: config.Namespace, batches: map[string]int{}, pending: map[string][]func(metadata map[string]KeyMetadata){}}
+}
+
+func (m *MetadataStore) hold(namespace string) {
+	m.batchMutex.Lock()
+	defer m.batchMutex.Unlock()
+	m.batches[namespace]++
+}
+
+// queue keeps the change for the end of the batch, it returns false when no batch is running for the namespace.
+func (m *MetadataStore) queue(namespace string, change func(metadata map[string]KeyMetadata)) bool {
+	m.batchMutex.Lock()
+	defer m.batchMutex.Unlock()
+	if m.batches[namespace] == 0 {
+		return false
+	}
+	m.pending[namespace] = append(m.pending[namespace], change)
+	return true
+}
+
+// release ends a batch and returns the queued changes when it was the last batch of the namespace.
+func (m *MetadataStore) release(namespace string) []func(metadata map[string]KeyMetadata) {
+	m.batchMutex.Lock()
+	defer m.batchMutex.Unlock()
+	if m.batches[namespace]--; m.batches[namespace] > 0 {
+		return nil
+	}
+	changes := m.pending[namespace]
+	delete(m.batches, namespace)
+	delete(m.pending, namespace)
+	return changes
+}
+
+// reservedNamespace reports whether the namespace holds data of the web tier, reserved namespaces are hidden.
+func (App *Application) reservedNamespace(namespace string) bool {
+	return namespace == App.Config.Metadata.Namespace || namespace == App.Config.Trash.Namespace
+}
+
+// parseTags splits a comma separated list into trimmed, lower case and unique tags.
+func parseTags(input string) []string {
+	var tags []string
+	for _, tag := range strings.Split(input, ",") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// loadMetadata returns the metadata of all keys in the namespace, a missing document or metadata namespace is empty.
+func (App *Application) loadMetadata(logger *slog.Logger, namespace string) (map[string]KeyMetadata, error) {
+	metadata := map[string]KeyMetadata{}
+	document, err := App.KVDBClient.GetKey(logger, App.Metadata.namespace, namespace)
+	var statusError *HTTPStatusError
+	if errors.As(err, &statusError) && statusError.StatusCode == http.StatusNotFound {
+		return metadata, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(document.Value), &metadata); err != nil {
+		return nil, fmt.Errorf("metadata of %v is not valid: %w", namespace, err)
+	}
+	return metadata, nil
+}
+
+func (App *Application) saveMetadata(logger *slog.Logger, namespace string, metadata map[string]KeyMetadata) error {
+	if len(metadata) == 0 {
+		err := App.KVDBClient.DeleteKey(logger, App.Metadata.namespace, namespace)
+		var statusError *HTTPStatusError
+		if errors.As(err, &statusError) && statusError.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	document, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	if !App.Metadata.created {
+		if err := App.ensureNamespace(logger, App.Metadata.namespace); err != nil {
+			return err
+		}
+		App.Metadata.created = true
+	}
+	return App.KVDBClient.SetKey(logger, App.Metadata.namespace, namespace, string(document))
+}
+
+// updateMetadata loads, changes and saves the metadata of a namespace while holding the store lock.
+func (App *Application) updateMetadata(logger *slog.Logger, namespace string, change func(metadata map[string]KeyMetadata)) error {
+	App.Metadata.mutex.Lock()
+	defer App.Metadata.mutex.Unlock()
+	metadata, err := App.loadMetadata(logger, namespace)
+	if err != nil {
+		return err
+	}
+	change(metadata)
+	if err := App.saveMetadata(logger, namespace, metadata); err != nil {
+		return err
+	}
+	App.Expiry.Set(namespace, metadata)
+	return nil
+}
+
+// batchMetadata runs batch with the metadata changes of the namespace held back, they are saved with one update
+// once the batch and all other batches of the namespace have ended.
+func (App *Application) batchMetadata(logger *slog.Logger, namespace string, batch func()) {
+	App.Metadata.hold(namespace)
+	defer func() {
+		changes := App.Metadata.release(namespace)
+		if len(changes) == 0 {
+			return
+		}
+		err := App.updateMetadata(logger, namespace, func(metadata map[string]KeyMetadata) {
+			for _, change := range changes {
+				change(metadata)
+			}
+		})
+		if err != nil {
+			logger.Error("Metadata update failed", "namespace", namespace, "changes", len(changes), "error", err)
+		}
+	}()
+	batch()
+}
+
+// trackMetadata keeps timestamps current and removes metadata of deleted keys and namespaces after backend changes.
+func (App *Application) trackMetadata(action string, namespace string, key string) {
+	logger := App.Logger.With(slog.Any("function", "trackMetadata")).With(slog.Any("struct", "Application"))
+	now := time.Now().UTC()
+	var change func(metadata map[string]KeyMetadata)
+	switch action {
+	case "SetKey", "Roll", "Generate":
+		if key == "" {
+			return
+		}
+		change = func(metadata map[string]KeyMetadata) {
+			entry := metadata[key]
+			if entry.Created.IsZero() {
+				entry.Created = now
+			}
+			entry.Updated = now
+			metadata[key] = entry
+		}
+	case "DeleteKey":
+		change = func(metadata map[string]KeyMetadata) { delete(metadata, key) }
+	case "DeleteNamespace":
+		change = func(metadata map[string]KeyMetadata) { clear(metadata) }
+	default:
+		return
+	}
+	if App.Metadata.queue(namespace, change) {
+		return
+	}
+	if err := App.updateMetadata(logger, namespace, change); err != nil {
+		logger.Error("Metadata update failed", "action", action, "namespace", namespace, "key", key, "error", err)
+	}
+}
+
+// changed is called by the backend client after every successful change, changes to reserved namespaces are internal.
+func (App *Application) changed(action string, namespace string, key string) {
+	if App.reservedNamespace(namespace) {
+		return
+	}
+	App.trackMetadata(action, namespace, key)
+	App.Webhooks.Notify(action, namespace, key)
+}
+
+// KeyMetadataController saves the description, owner, tags and expiry date of a key from the key list.
+func (App *Application) KeyMetadataController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "KeyMetadataController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Key Metadata Request")
+	if request.Method != "POST" {
+		http.Redirect(w, request.orgRequest, "/"+request.Api+"/"+request.Namespace+"/", http.StatusSeeOther)
+		return
+	}
+	if !App.parsePost(logger, w, request) {
+		return
+	}
+	requests.WithLabelValues(request.Path, request.Method, "Metadata").Inc()
+	form := request.orgRequest.PostForm
+	key := form.Get("key")
+	if !App.authorize(logger, w, request, request.Namespace, RoleEditor, "Metadata") {
+		return
+	}
+	if !App.keyWritable(request.Namespace, key) {
+		App.auditDenied(request, "Metadata", request.Namespace, key, "protected key")
+		App.ForbiddenHandler(logger, w, request)
+		return
+	}
+	expires, err := parseExpiry(form.Get("expires"))
+	if err != nil {
+		debugLogger.Debug("Expiry Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	kvlist, err := App.keyList(logger, request.Namespace)
+	if err != nil {
+		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	if _, exists := pairsToMap(kvlist)[key]; !exists {
+		logger.Info("Key not found", "namespace", request.Namespace, "key", key, "status", http.StatusNotFound)
+		http.NotFound(w, request.orgRequest)
+		return
+	}
+	err = App.updateMetadata(logger, request.Namespace, func(metadata map[string]KeyMetadata) {
+		entry := metadata[key]
+		entry.Description = strings.TrimSpace(form.Get("description"))
+		entry.Owner = strings.TrimSpace(form.Get("owner"))
+		entry.Tags = parseTags(form.Get("tags"))
+		entry.Expires = expires
+		metadata[key] = entry
+	})
+	App.audit(request, "Metadata", request.Namespace, key, err)
+	if err != nil {
+		debugLogger.Debug("Metadata Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	logger.Info("Key metadata saved", "namespace", request.Namespace, "key", key, "status", http.StatusSeeOther)
+	http.Redirect(w, request.orgRequest, "/"+request.Api+"/"+request.Namespace+"/", http.StatusSeeOther)
+}
+
+// renameKey copies the value to the new key and moves the original to the trash together with its metadata,
+// existing keys are not overwritten.
+func (App *Application) renameKey(logger *slog.Logger, user string, namespace string, original string, key string) error {
+	list, err := App.KVDBClient.GetKeyList(logger, namespace)
+	if err != nil {
+		return err
+	}
+	existing := pairsToMap(list)
+	value, found := existing[original]
+	if !found {
+		return fmt.Errorf("key %v does not exist", original)
+	}
+	if _, exists := existing[key]; exists {
+		return fmt.Errorf("key %v already exists", key)
+	}
+	if err := App.validateKeyValue(namespace, key, value); err != nil {
+		return err
+	}
+	metadata, err := App.loadMetadata(logger, namespace)
+	if err != nil {
+		return err
+	}
+	if err := App.KVDBClient.SetKey(logger, namespace, key, value); err != nil {
+		return err
+	}
+	if err := App.deleteKey(logger, user, namespace, original); err != nil {
+		return err
+	}
+	if entry, exists := metadata[original]; exists {
+		return App.updateMetadata(logger, namespace, func(metadata map[string]KeyMetadata) {
+			entry.Updated = metadata[key].Updated
+			metadata[key] = entry
+		})
+	}
+	return nil
+}
+
+// applyMetadata adds the metadata to the key list and keeps only keys tagged with tag when it is set.
+func (App *Application) applyMetadata(logger *slog.Logger, list *KeyValueList, tag string) error {
+	metadata, err := App.loadMetadata(logger, list.Namespace)
+	if err != nil {
+		return err
+	}
+	list.Tag = tag
+	now := time.Now()
+	for i := range list.Items {
+		list.Items[i].Metadata = metadata[list.Items[i].Key]
+		list.Items[i].Expiry = App.expiryState(list.Items[i].Metadata.Expires, now)
+		for _, itemTag := range list.Items[i].Metadata.Tags {
+			if !slices.Contains(list.Tags, itemTag) {
+				list.Tags = append(list.Tags, itemTag)
+			}
+		}
+	}
+	slices.Sort(list.Tags)
+	if tag != "" {
+		list.Items = slices.DeleteFunc(list.Items, func(item KeyValue) bool { return !slices.Contains(item.Metadata.Tags, tag) })
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+type NamespaceDelete struct {
+	Page
+	Namespace string
+	KeyCount  int
+	Protected bool
+	Confirm   string
+	Error     string
+}
+
+// NamespaceDeleteController shows the confirmation page for deleting a namespace and deletes it once the name has been typed.
+func (App *Application) NamespaceDeleteController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "NamespaceDeleteController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Namespace Delete Request")
+	statuscode := http.StatusOK
+	page := NamespaceDelete{Page: App.newPage(request), Namespace: request.Namespace, Protected: App.protection(request.Namespace, "").NoDelete}
+	if request.Method == "POST" {
+		if !App.parsePost(logger, w, request) {
+			return
+		}
+		requests.WithLabelValues(request.Path, request.Method, "DeleteNamespace").Inc()
+		if !App.authorize(logger, w, request, request.Namespace, RoleAdmin, "DeleteNamespace") {
+			return
+		}
+		page.Confirm = request.orgRequest.PostFormValue("confirm")
+		switch {
+		case page.Protected:
+			statuscode = http.StatusForbidden
+			page.Error = fmt.Sprintf("Namespace %v is protected and can not be deleted from the interface", request.Namespace)
+			App.auditDenied(request, "DeleteNamespace", request.Namespace, "", "protected namespace")
+		case page.Confirm != request.Namespace:
+			statuscode = http.StatusBadRequest
+			page.Error = "The typed name does not match the namespace"
+		default:
+			err := App.deleteNamespace(logger, request.Identity.User, request.Namespace)
+			App.audit(request, "DeleteNamespace", request.Namespace, "", err)
+			if err == nil {
+				logger.Info("Namespace deleted", "namespace", request.Namespace, "status", http.StatusSeeOther)
+				http.Redirect(w, request.orgRequest, "/"+request.Api, http.StatusSeeOther)
+				return
+			}
+			debugLogger.Debug("DeleteNamespace Error", "type", fmt.Sprintf("%t", err), "error", err)
+			statuscode = http.StatusBadGateway
+			page.Error = fmt.Sprintf("Deleting namespace failed: %v", err)
+		}
+	} else {
+		requests.WithLabelValues(request.Path, request.Method, "").Inc()
+	}
+	kvlist, err := App.KVDBClient.GetKeyList(logger, request.Namespace)
+	if err != nil {
+		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	page.KeyCount = len(kvlist)
+	logger.Info("Namespace delete request", "status", statuscode)
+	App.renderPage(logger, w, statuscode, "namespacedelete.html", page)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcFlowCookieName = "kvdbw_oidc"
+	oidcFlowMaxAge     = 10 * time.Minute
+)
+
+type ConfigOIDC struct {
+	Issuer       string   `mapstructure:"issuer"`
+	ClientID     string   `mapstructure:"clientId"`
+	ClientSecret string   `mapstructure:"clientSecret"`
+	RedirectURL  string   `mapstructure:"redirectUrl"`
+	Scopes       []string `mapstructure:"scopes"`
+	UserClaim    string   `mapstructure:"userClaim"`
+	GroupsClaim  string   `mapstructure:"groupsClaim"`
+}
+
+// oidcFlow is the state of a login in progress, kept in an encrypted cookie between login and callback.
+type oidcFlow struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Next     string `json:"next"`
+}
+
+type OIDCClient struct {
+	config     ConfigOIDC
+	mutex      sync.Mutex
+	provider   *oidc.Provider
+	endSession string
+}
+
+func NewOIDCClient(config ConfigOIDC) *OIDCClient {
+	return &OIDCClient{config: config}
+}
+
+// Provider discovers the issuer on first use so the interface can start while the identity provider is unavailable.
+func (c *OIDCClient) Provider(ctx context.Context) (*oidc.Provider, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.provider != nil {
+		return c.provider, nil
+	}
+	provider, err := oidc.NewProvider(ctx, c.config.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	var metadata struct {
+		EndSession string `json:"end_session_endpoint"`
+	}
+	provider.Claims(&metadata)
+	c.provider, c.endSession = provider, metadata.EndSession
+	return provider, nil
+}
+
+func (c *OIDCClient) oauth2Config(provider *oidc.Provider, redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.config.ClientID,
+		ClientSecret: c.config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       c.config.Scopes,
+	}
+}
+
+func (c *OIDCClient) redirectURL(r *http.Request) string {
+	if c.config.RedirectURL != "" {
+		return c.config.RedirectURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := r.Header.Get("X-Forwarded-Proto"); forwarded != "" {
+		scheme = forwarded
+	}
+	return scheme + "://" + r.Host + "/auth/callback"
+}
+
+func claimString(claims map[string]any, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func claimStrings(claims map[string]any, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return strings.Split(value, ",")
+	case []any:
+		var values []string
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// identityFromClaims takes the user from the configured claim falling back to email and subject.
+func (c *OIDCClient) identityFromClaims(claims map[string]any) Identity {
+	identity := Identity{Groups: claimStrings(claims, c.config.GroupsClaim)}
+	for _, name := range []string{c.config.UserClaim, "email", "sub"} {
+		if identity.User = claimString(claims, name); identity.User != "" {
+			break
+		}
+	}
+	return identity
+}
+
+// localRedirect only allows redirects to paths on this host.
+func localRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/v1"
+	}
+	return next
+}
+
+func (App *Application) OIDCLogin(w http.ResponseWriter, request *RequestParameters, logger *slog.Logger) {
+	r := request.orgRequest
+	provider, err := App.OIDC.Provider(r.Context())
+	if err != nil {
+		logger.Error("OIDC discovery failed", "issuer", App.Config.OIDC.Issuer, "error", err)
+		App.InternalServerErrorHandler(logger, w)
+		return
+	}
+	flow := oidcFlow{State: RandomToken(16), Nonce: RandomToken(16), Verifier: oauth2.GenerateVerifier(), Next: localRedirect(r.URL.Query().Get("next"))}
+	sealed, err := App.Sessions.Seal(oidcFlowCookieName, flow)
+	if err != nil {
+		App.InternalServerErrorHandler(logger, w)
+		return
+	}
+	http.SetCookie(w, App.sessionCookie(oidcFlowCookieName, sealed, oidcFlowMaxAge))
+	authURL := App.OIDC.oauth2Config(provider, App.OIDC.redirectURL(r)).AuthCodeURL(flow.State, oidc.Nonce(flow.Nonce), oauth2.S256ChallengeOption(flow.Verifier))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (App *Application) oidcExchange(r *http.Request, flow oidcFlow) (Identity, error) {
+	if errorCode := r.URL.Query().Get("error"); errorCode != "" {
+		return Identity{}, fmt.Errorf("provider returned %v: %v", errorCode, r.URL.Query().Get("error_description"))
+	}
+	if r.URL.Query().Get("state") != flow.State {
+		return Identity{}, errors.New("state mismatch")
+	}
+	provider, err := App.OIDC.Provider(r.Context())
+	if err != nil {
+		return Identity{}, err
+	}
+	token, err := App.OIDC.oauth2Config(provider, App.OIDC.redirectURL(r)).Exchange(r.Context(), r.URL.Query().Get("code"), oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return Identity{}, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, errors.New("no id_token in token response")
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: App.Config.OIDC.ClientID}).Verify(r.Context(), rawIDToken)
+	if err != nil {
+		return Identity{}, err
+	}
+	if idToken.Nonce != flow.Nonce {
+		return Identity{}, errors.New("nonce mismatch")
+	}
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, err
+	}
+	identity := App.OIDC.identityFromClaims(claims)
+	if identity.User == "" {
+		return Identity{}, errors.New("no user claim in id_token")
+	}
+	return identity, nil
+}
+
+func (App *Application) OIDCCallback(w http.ResponseWriter, request *RequestParameters, logger *slog.Logger) {
+	r := request.orgRequest
+	var flow oidcFlow
+	cookie, err := r.Cookie(oidcFlowCookieName)
+	if err == nil {
+		err = App.Sessions.Open(oidcFlowCookieName, cookie.Value, &flow)
+	}
+	App.clearCookie(w, oidcFlowCookieName)
+	if err != nil {
+		logger.Info("OIDC callback without login in progress", "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	identity, err := App.oidcExchange(r, flow)
+	request.Identity = identity
+	App.audit(request, "Login", "", "", err)
+	if err != nil {
+		logger.Info("OIDC login failed", "error", err)
+		App.ForbiddenHandler(logger, w, request)
+		return
+	}
+	if err := App.startSession(w, identity); err != nil {
+		App.InternalServerErrorHandler(logger, w)
+		return
+	}
+	logger.Info("OIDC login", "user", identity.User)
+	http.Redirect(w, r, flow.Next, http.StatusSeeOther)
+}
+
+// OIDCLogout ends the local session and continues to the end session endpoint of the provider when it has one.
+func (App *Application) OIDCLogout(w http.ResponseWriter, request *RequestParameters, logger *slog.Logger) {
+	App.clearCookie(w, sessionCookieName)
+	App.audit(request, "Logout", "", "", nil)
+	target := "/"
+	if _, err := App.OIDC.Provider(request.orgRequest.Context()); err == nil && App.OIDC.endSession != "" {
+		if endSession, err := url.Parse(App.OIDC.endSession); err == nil {
+			query := endSession.Query()
+			query.Set("client_id", App.Config.OIDC.ClientID)
+			endSession.RawQuery = query.Encode()
+			target = endSession.String()
+		}
+	}
+	http.Redirect(w, request.orgRequest, target, http.StatusSeeOther)
+}
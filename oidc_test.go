@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+	"golang.org/x/oauth2"
+)
+
+// mockIssuer is a minimal OpenID provider with discovery, keys and a token endpoint that enforces PKCE.
+type mockIssuer struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                issuer.server.URL,
+			"authorization_endpoint":                issuer.server.URL + "/authorize",
+			"token_endpoint":                        issuer.server.URL + "/token",
+			"jwks_uri":                              issuer.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != issuer.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "access", "token_type": "Bearer", "id_token": issuer.idToken(t)})
+	})
+	return issuer
+}
+
+func (m *mockIssuer) idToken(t *testing.T) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: m.key}, (&jose.SignerOptions{}).WithHeader("kid", "test"))
+	if err != nil {
+		t.Error(err)
+		return ""
+	}
+	claims, _ := json.Marshal(map[string]any{
+		"iss":                m.server.URL,
+		"sub":                "1",
+		"aud":                "kvdbw",
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              m.nonce,
+		"preferred_username": "dave",
+		"groups":             []string{"ops"},
+	})
+	signed, err := signer.Sign(claims)
+	if err != nil {
+		t.Error(err)
+		return ""
+	}
+	token, _ := signed.CompactSerialize()
+	return token
+}
+
+func newOIDCTestApp(t *testing.T, issuer string) *Application {
+	t.Helper()
+	App := new(Application)
+	App.Config.OIDC = ConfigOIDC{Issuer: issuer, ClientID: "kvdbw", RedirectURL: "http://kvdbw.test/auth/callback", Scopes: []string{"openid"}, UserClaim: "preferred_username", GroupsClaim: "groups"}
+	App.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	App.OIDC = NewOIDCClient(App.Config.OIDC)
+	sessions, err := NewSessionStore("", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	App.Sessions = sessions
+	auditor, err := NewAuditor(ConfigAudit{}, App.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	App.Auditor = auditor
+	return App
+}
+
+func TestOIDCExchange(t *testing.T) {
+	issuer := newMockIssuer(t)
+	App := newOIDCTestApp(t, issuer.server.URL)
+	flow := oidcFlow{State: "state", Nonce: "nonce", Verifier: oauth2.GenerateVerifier(), Next: "/v1"}
+	tests := []struct {
+		name      string
+		query     string
+		challenge string
+		nonce     string
+		err       string
+	}{
+		{name: "success", query: "code=c&state=state", challenge: oauth2.S256ChallengeFromVerifier(flow.Verifier), nonce: "nonce"},
+		{name: "provider error", query: "error=access_denied&state=state", err: "access_denied"},
+		{name: "state mismatch", query: "code=c&state=other", challenge: oauth2.S256ChallengeFromVerifier(flow.Verifier), nonce: "nonce", err: "state mismatch"},
+		{name: "missing state", query: "code=c", challenge: oauth2.S256ChallengeFromVerifier(flow.Verifier), nonce: "nonce", err: "state mismatch"},
+		{name: "verifier mismatch", query: "code=c&state=state", challenge: oauth2.S256ChallengeFromVerifier(oauth2.GenerateVerifier()), nonce: "nonce", err: "invalid_grant"},
+		{name: "nonce mismatch", query: "code=c&state=state", challenge: oauth2.S256ChallengeFromVerifier(flow.Verifier), nonce: "replayed", err: "nonce mismatch"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			issuer.challenge, issuer.nonce = test.challenge, test.nonce
+			r := httptest.NewRequest("GET", "/auth/callback?"+test.query, nil)
+			identity, err := App.oidcExchange(r, flow)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if identity.User != "dave" || len(identity.Groups) != 1 || identity.Groups[0] != "ops" {
+					t.Fatalf("unexpected identity %+v", identity)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+			if identity.User != "" {
+				t.Fatalf("identity returned with error: %+v", identity)
+			}
+		})
+	}
+}
+
+func TestOIDCCallback(t *testing.T) {
+	issuer := newMockIssuer(t)
+	App := newOIDCTestApp(t, issuer.server.URL)
+	flow := oidcFlow{State: "state", Nonce: "nonce", Verifier: oauth2.GenerateVerifier(), Next: "/v1/app/"}
+	issuer.challenge, issuer.nonce = oauth2.S256ChallengeFromVerifier(flow.Verifier), flow.Nonce
+	sealed, err := App.Sessions.Seal(oidcFlowCookieName, flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := NewSessionStore("other", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedFlow, _ := forged.Seal(oidcFlowCookieName, flow)
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+		status int
+	}{
+		{name: "no login in progress", query: "code=c&state=state", status: http.StatusBadRequest},
+		{name: "forged flow cookie", query: "code=c&state=state", cookie: forgedFlow, status: http.StatusBadRequest},
+		{name: "state mismatch", query: "code=c&state=other", cookie: sealed, status: http.StatusForbidden},
+		{name: "success", query: "code=c&state=state", cookie: sealed, status: http.StatusSeeOther},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/auth/callback?"+test.query, nil)
+			if test.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: oidcFlowCookieName, Value: test.cookie})
+			}
+			w := httptest.NewRecorder()
+			App.OIDCCallback(w, GetRequestParameters(r), App.Logger)
+			if w.Code != test.status {
+				t.Fatalf("expected status %v, got %v", test.status, w.Code)
+			}
+			var session bool
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.Name == sessionCookieName && cookie.Value != "" {
+					session = true
+				}
+			}
+			if session != (test.status == http.StatusSeeOther) {
+				t.Fatalf("session cookie issued: %v", session)
+			}
+			if test.status == http.StatusSeeOther && w.Header().Get("Location") != flow.Next {
+				t.Fatalf("expected redirect to %v, got %v", flow.Next, w.Header().Get("Location"))
+			}
+		})
+	}
+}
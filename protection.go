@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log/slog"
+	"path"
+	"slices"
+
+	"github.com/SimonStiil/keyvaluedatabase/rest"
+)
+
+const (
+	ProtectionReadOnly = "read-only"
+	ProtectionNoDelete = "no-delete"
+	ProtectionHidden   = "hidden"
+)
+
+// ConfigNamespaces is the configuration before protection rules, Undeletable is read as no-delete rules.
+type ConfigNamespaces struct {
+	Undeletable []string `mapstructure:"undeletable"`
+}
+
+// ConfigProtectionRule protects the namespaces matching Namespaces, or only the keys matching Keys in them when Keys is set.
+type ConfigProtectionRule struct {
+	Namespaces []string `mapstructure:"namespaces"`
+	Keys       []string `mapstructure:"keys"`
+	Mode       string   `mapstructure:"mode"`
+}
+
+// Protection is the combined effect of the rules matching a namespace or key, hidden implies read-only and read-only implies no-delete.
+type Protection struct {
+	Hidden   bool
+	ReadOnly bool
+	NoDelete bool
+}
+
+func matchPatterns(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+func (p *Protection) add(mode string) {
+	switch mode {
+	case ProtectionHidden:
+		p.Hidden, p.ReadOnly, p.NoDelete = true, true, true
+	case ProtectionReadOnly:
+		p.ReadOnly, p.NoDelete = true, true
+	case ProtectionNoDelete:
+		p.NoDelete = true
+	}
+}
+
+// protection returns the protection of the namespace when key is empty, keys also get the read-only and hidden protection
+// of their namespace. A no-delete rule without keys only keeps the namespace itself from being deleted.
+func (App *Application) protection(namespace string, key string) Protection {
+	var protection Protection
+	if App.reservedNamespace(namespace) {
+		protection.add(ProtectionHidden)
+	}
+	for _, rule := range App.Config.Protection {
+		if !matchPatterns(rule.Namespaces, namespace) {
+			continue
+		}
+		switch {
+		case len(rule.Keys) > 0:
+			if key != "" && matchPatterns(rule.Keys, key) {
+				protection.add(rule.Mode)
+			}
+		case key == "" || rule.Mode != ProtectionNoDelete:
+			protection.add(rule.Mode)
+		}
+	}
+	return protection
+}
+
+// protectedRole hides protected namespaces and limits read-only namespaces to viewing.
+func (App *Application) protectedRole(namespace string, role Role) Role {
+	protection := App.protection(namespace, "")
+	switch {
+	case protection.Hidden:
+		return RoleNone
+	case protection.ReadOnly:
+		return min(role, RoleViewer)
+	}
+	return role
+}
+
+// visibleKeys removes hidden keys from a key list before it is shown, exported or copied.
+func (App *Application) visibleKeys(namespace string, list []rest.KVPairV2) []rest.KVPairV2 {
+	return slices.DeleteFunc(list, func(pair rest.KVPairV2) bool { return App.protection(namespace, pair.Key).Hidden })
+}
+
+// keyList returns the keys of a namespace without the hidden keys.
+func (App *Application) keyList(logger *slog.Logger, namespace string) ([]rest.KVPairV2, error) {
+	list, err := App.KVDBClient.GetKeyList(logger, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return App.visibleKeys(namespace, list), nil
+}
+
+// keyWritable reports if a key may be created or changed by the interface.
+func (App *Application) keyWritable(namespace string, key string) bool {
+	return !App.protection(namespace, key).ReadOnly
+}
+
+func protectedKeyResult(key string) KeyResult {
+	return KeyResult{Key: key, Result: "Failed", Error: "key is protected"}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/SimonStiil/keyvaluedatabase/rest"
+)
+
+type ConfigReport struct {
+	MinEntropy float64 `mapstructure:"minEntropy"`
+	MinLength  int     `mapstructure:"minLength"`
+}
+
+// commonPasswords and keyboardPatterns are matched case insensitive anywhere in a value.
+var commonPasswords = []string{"password", "passwd", "secret", "admin", "root", "changeme", "letmein", "welcome", "default", "master", "login", "test", "guest", "dragon", "monkey", "iloveyou", "trustno1", "abc123", "123456", "111111", "000000"}
+var keyboardPatterns = []string{"qwerty", "qwertz", "azerty", "asdf", "zxcv", "1qaz", "2wsx", "!qaz"}
+
+// SecretAnalysis describes a value without revealing it.
+type SecretAnalysis struct {
+	Key         string   `json:"key"`
+	Length      int      `json:"length"`
+	Classes     []string `json:"classes"`
+	Entropy     float64  `json:"entropyBits"`
+	Fingerprint string   `json:"fingerprint"`
+	Findings    []string `json:"findings,omitempty"`
+	Skipped     string   `json:"skipped,omitempty"`
+	Weak        bool     `json:"weak"`
+	Rollable    bool     `json:"-"`
+}
+
+type SecretReport struct {
+	Page       `json:"-"`
+	Namespace  string           `json:"namespace"`
+	Generated  time.Time        `json:"generated"`
+	MinEntropy float64          `json:"minEntropyBits"`
+	MinLength  int              `json:"minLength"`
+	Weak       int              `json:"weak"`
+	Keys       []SecretAnalysis `json:"keys"`
+	Results    []KeyResult      `json:"-"`
+	Generator  string           `json:"-"`
+}
+
+func characterClassesOf(value string) ([]string, int) {
+	present := map[string]bool{}
+	for _, r := range value {
+		switch {
+		case r >= 'a' && r <= 'z':
+			present["lower"] = true
+		case r >= 'A' && r <= 'Z':
+			present["upper"] = true
+		case r >= '0' && r <= '9':
+			present["digits"] = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			present["symbols"] = true
+		default:
+			present["other"] = true
+		}
+	}
+	sizes := map[string]int{"lower": 26, "upper": 26, "digits": 10, "symbols": 33, "other": 100}
+	var classes []string
+	pool := 0
+	for _, class := range []string{"lower", "upper", "digits", "symbols", "other"} {
+		if present[class] {
+			classes = append(classes, class)
+			pool += sizes[class]
+		}
+	}
+	return classes, pool
+}
+
+// analyseSecret estimates entropy from the character pool, characters that repeat or continue a sequence and
+// common words count as a single character.
+func analyseSecret(value string, minEntropy float64, minLength int) SecretAnalysis {
+	runes := []rune(value)
+	analysis := SecretAnalysis{Length: len(runes)}
+	var pool int
+	analysis.Classes, pool = characterClassesOf(value)
+	if len(runes) == 0 {
+		analysis.Findings = append(analysis.Findings, "empty")
+		analysis.Weak = true
+		return analysis
+	}
+	effective := len(runes)
+	repeats, sequences := 0, 0
+	for i := 1; i < len(runes); i++ {
+		switch runes[i] - runes[i-1] {
+		case 0:
+			repeats++
+		case 1, -1:
+			sequences++
+		}
+	}
+	if repeats >= 2 {
+		analysis.Findings = append(analysis.Findings, "repeated characters")
+	}
+	if sequences >= 2 {
+		analysis.Findings = append(analysis.Findings, "character sequences")
+	}
+	effective -= repeats + sequences
+	lower := strings.ToLower(value)
+	for _, list := range []struct {
+		finding string
+		words   []string
+	}{{"common password", commonPasswords}, {"keyboard pattern", keyboardPatterns}} {
+		for _, word := range list.words {
+			if strings.Contains(lower, word) {
+				if !slices.Contains(analysis.Findings, list.finding) {
+					analysis.Findings = append(analysis.Findings, list.finding)
+				}
+				effective -= len(word) - 1
+			}
+		}
+	}
+	if len(analysis.Classes) == 1 && analysis.Classes[0] == "digits" {
+		analysis.Findings = append(analysis.Findings, "only digits")
+	}
+	if len(runes) < minLength {
+		analysis.Findings = append(analysis.Findings, fmt.Sprintf("shorter than %v characters", minLength))
+	}
+	analysis.Entropy = math.Round(float64(max(effective, 1))*math.Log2(float64(pool))*10) / 10
+	if analysis.Entropy < minEntropy {
+		analysis.Findings = append(analysis.Findings, fmt.Sprintf("less than %v bits of entropy", minEntropy))
+	}
+	analysis.Weak = len(analysis.Findings) > 0
+	return analysis
+}
+
+// analyseNamespace analyses every text value and flags values shared between keys, files and JSON or YAML documents are skipped.
+func (App *Application) analyseNamespace(namespace string, list []rest.KVPairV2) []SecretAnalysis {
+	byValue := map[string][]string{}
+	for _, pair := range list {
+		byValue[pair.Value] = append(byValue[pair.Value], pair.Key)
+	}
+	var analyses []SecretAnalysis
+	for _, pair := range list {
+		var analysis SecretAnalysis
+		if binary, ok := parseBinaryValue(pair.Value); ok {
+			analysis = SecretAnalysis{Length: len(binary.Data), Skipped: "file"}
+		} else if format := detectValueFormat(pair.Value); format != ValueFormatText {
+			analysis = SecretAnalysis{Length: len(pair.Value), Skipped: format + " document"}
+		} else {
+			analysis = analyseSecret(pair.Value, App.Config.Report.MinEntropy, App.Config.Report.MinLength)
+			if shared := byValue[pair.Value]; len(shared) > 1 && pair.Value != "" {
+				others := slices.DeleteFunc(slices.Clone(shared), func(key string) bool { return key == pair.Key })
+				analysis.Findings = append(analysis.Findings, "reused by "+strings.Join(others, ", "))
+				analysis.Weak = true
+			}
+		}
+		analysis.Key, analysis.Fingerprint = pair.Key, ValueFingerprint(App.FingerprintKey, pair.Value)
+		analyses = append(analyses, analysis)
+	}
+	slices.SortStableFunc(analyses, func(a, b SecretAnalysis) int {
+		if a.Weak != b.Weak {
+			if a.Weak {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return analyses
+}
+
+// NamespaceReportController shows the weak secret report of a namespace, ?format=json downloads it and Roll replaces a weak value.
+func (App *Application) NamespaceReportController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "NamespaceReportController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Namespace Report Request")
+	statuscode := http.StatusOK
+	report := SecretReport{Page: App.newPage(request), Namespace: request.Namespace, MinEntropy: App.Config.Report.MinEntropy, MinLength: App.Config.Report.MinLength, Generator: App.Generators.Default(request.Namespace)}
+	if request.Method == "POST" {
+		if !App.parsePost(logger, w, request) {
+			return
+		}
+		function := request.orgRequest.PostFormValue("input")
+		requests.WithLabelValues(request.Path, request.Method, function).Inc()
+		key := request.orgRequest.PostFormValue("key")
+		if function != "Roll" {
+			debugLogger.Debug("Unknown post", "function", function)
+			App.BadRequestHandler(logger, w, request)
+			return
+		}
+		if !App.authorize(logger, w, request, request.Namespace, RoleEditor, "Roll") {
+			return
+		}
+		result := KeyResult{Key: key, Result: "Rolled"}
+		if !App.keyWritable(request.Namespace, key) {
+			result = protectedKeyResult(key)
+		} else if App.binaryKey(logger, request.Namespace, key) {
+			result.Result, result.Error = "Failed", binaryRollError
+		} else if err := App.generateKey(logger, request.Namespace, key, report.Generator, true); err != nil {
+			result.Result, result.Error = "Failed", err.Error()
+		}
+		report.Results = []KeyResult{result}
+		App.auditResults(request, "Roll", request.Namespace, report.Results)
+	} else {
+		requests.WithLabelValues(request.Path, request.Method, "Report").Inc()
+	}
+	kvlist, err := App.keyList(logger, request.Namespace)
+	if err != nil {
+		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	report.Generated = time.Now().UTC()
+	report.Keys = App.analyseNamespace(request.Namespace, kvlist)
+	for i := range report.Keys {
+		if report.Keys[i].Weak {
+			report.Weak++
+			report.Keys[i].Rollable = report.Role.CanEdit() && App.keyWritable(request.Namespace, report.Keys[i].Key)
+		}
+	}
+	if request.orgRequest.URL.Query().Get("format") == "json" {
+		body, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			App.InternalServerErrorHandler(logger, w)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", request.Namespace+"-report.json"))
+		logger.Info("Namespace report request", "format", "json", "status", statuscode)
+		w.Write(body)
+		return
+	}
+	logger.Info("Namespace report request", "status", statuscode)
+	App.renderPage(logger, w, statuscode, "namespacereport.html", report)
+}
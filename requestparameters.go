@@ -10,21 +10,28 @@ type RequestParameters struct {
 	Method     string
 	Api        string
 	Namespace  string
+	Action     string
 	Path       string
 	orgRequest *http.Request
 	RequestIP  string
 	ID         int
+	CSRFToken  string
+	Nonce      string
+	Identity   Identity
 }
 
 func GetRequestParameters(r *http.Request) *RequestParameters {
 	slashSeperated := strings.Split(r.URL.Path[1:], "/")
-	req := &RequestParameters{Method: r.Method, orgRequest: r, ID: RandomID(), Path: r.URL.EscapedPath()}
+	req := &RequestParameters{Method: r.Method, orgRequest: r, ID: RandomID(), Path: r.URL.EscapedPath(), Nonce: CSPNonce(r)}
 	if len(slashSeperated) > 0 {
 		req.Api = slashSeperated[0]
 	}
 	if len(slashSeperated) > 1 {
 		req.Namespace = slashSeperated[1]
 	}
+	if len(slashSeperated) > 2 {
+		req.Action = slashSeperated[2]
+	}
 	return req
 }
 func RandomID() int {
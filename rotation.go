@@ -0,0 +1,408 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	rotations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "kvdbw_rotations_count",
+		Help: "The amount of scheduled rotations by policy and outcome",
+	}, []string{"policy", "outcome"},
+	)
+	rotationNext = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kvdbw_rotation_next_timestamp_seconds",
+		Help: "When the policy is next due as a unix timestamp",
+	}, []string{"policy"},
+	)
+)
+
+type ConfigRotation struct {
+	DryRun        bool                   `mapstructure:"dryRun"`
+	Jitter        time.Duration          `mapstructure:"jitter"`
+	CheckInterval time.Duration          `mapstructure:"checkInterval"`
+	History       int                    `mapstructure:"history"`
+	Policies      []ConfigRotationPolicy `mapstructure:"policies"`
+}
+
+// ConfigRotationPolicy rolls the keys matching Keys in namespaces matching Namespaces every Interval or on the cron
+// Schedule, keys without wildcards that do not exist yet are generated.
+type ConfigRotationPolicy struct {
+	Name       string        `mapstructure:"name"`
+	Namespaces []string      `mapstructure:"namespaces"`
+	Keys       []string      `mapstructure:"keys"`
+	Interval   time.Duration `mapstructure:"interval"`
+	Schedule   string        `mapstructure:"schedule"`
+	Generator  string        `mapstructure:"generator"`
+}
+
+// RotationEvent records the outcome for one key, like audit events it never contains values.
+type RotationEvent struct {
+	Time      time.Time
+	Policy    string
+	Namespace string
+	Key       string
+	Action    string
+	Outcome   string
+	Error     string
+}
+
+type rotationPolicy struct {
+	ConfigRotationPolicy
+	schedule cron.Schedule
+}
+
+// Rotator decides when keys are due from their last change, the updated time kept in the metadata namespace, so
+// restarts and other instances see the same times. Keys without a recorded change are scheduled from when a check
+// first saw them. rotated and seen remember rotations and first sightings made here in case the metadata could not be
+// saved and in dry-run mode, where nothing changes in the backend.
+type Rotator struct {
+	config   ConfigRotation
+	policies []*rotationPolicy
+	mutex    sync.Mutex
+	rotated  map[string]time.Time
+	seen     map[string]time.Time
+	last     map[string]time.Time
+	history  []RotationEvent
+}
+
+// NewRotator checks the policies and parses their schedules.
+func NewRotator(config ConfigRotation, generators *Generators) (*Rotator, error) {
+	rotator := &Rotator{config: config, rotated: map[string]time.Time{}, seen: map[string]time.Time{}, last: map[string]time.Time{}}
+	for _, policy := range config.Policies {
+		if policy.Name == "" || slices.ContainsFunc(rotator.policies, func(p *rotationPolicy) bool { return p.Name == policy.Name }) {
+			return nil, fmt.Errorf("rotation policy name %q is empty or used twice", policy.Name)
+		}
+		if len(policy.Namespaces) == 0 || len(policy.Keys) == 0 {
+			return nil, fmt.Errorf("rotation policy %v: namespaces and keys are required", policy.Name)
+		}
+		if policy.Generator != "" && !slices.Contains(generators.Names(), policy.Generator) {
+			return nil, fmt.Errorf("rotation policy %v: unknown generator %q", policy.Name, policy.Generator)
+		}
+		scheduled := &rotationPolicy{ConfigRotationPolicy: policy}
+		switch {
+		case policy.Interval > 0 && policy.Schedule != "":
+			return nil, fmt.Errorf("rotation policy %v: use either interval or schedule", policy.Name)
+		case policy.Interval > 0:
+			scheduled.schedule = cron.Every(policy.Interval)
+		case policy.Schedule != "":
+			schedule, err := cron.ParseStandard(policy.Schedule)
+			if err != nil {
+				return nil, fmt.Errorf("rotation policy %v: %w", policy.Name, err)
+			}
+			scheduled.schedule = schedule
+		default:
+			return nil, fmt.Errorf("rotation policy %v: an interval or schedule is required", policy.Name)
+		}
+		rotator.policies = append(rotator.policies, scheduled)
+	}
+	return rotator, nil
+}
+
+// jitter delays a key by a share of rotation.jitter taken from its name, so keys do not all roll at once and every
+// instance plans the same time.
+func (r *Rotator) jitter(namespace string, key string) time.Duration {
+	if r.config.Jitter <= 0 {
+		return 0
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(namespace + "/" + key))
+	return time.Duration(hash.Sum64() % uint64(r.config.Jitter))
+}
+
+// lastRotation is the latest of the updated and first seen times from the metadata and a rotation or first sighting
+// on this instance, zero when the key was never seen.
+func (r *Rotator) lastRotation(namespace string, key string, entry KeyMetadata) time.Time {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	last := entry.Updated
+	for _, when := range []time.Time{entry.Seen, r.rotated[namespace+"/"+key], r.seen[namespace+"/"+key]} {
+		if when.After(last) {
+			last = when
+		}
+	}
+	return last
+}
+
+// see remembers when this instance first saw a key without a recorded change.
+func (r *Rotator) see(namespace string, key string, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.seen[namespace+"/"+key]; !ok {
+		r.seen[namespace+"/"+key] = now
+	}
+}
+
+// next is when the key is due after its last rotation.
+func (r *Rotator) next(policy *rotationPolicy, namespace string, key string, last time.Time) time.Time {
+	return policy.schedule.Next(last).Add(r.jitter(namespace, key))
+}
+
+func (r *Rotator) record(policy string, now time.Time, events []RotationEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, event := range events {
+		if event.Outcome == "success" || event.Outcome == "dry-run" {
+			r.rotated[event.Namespace+"/"+event.Key] = now
+		}
+	}
+	if len(events) > 0 {
+		r.last[policy] = now
+	}
+	r.history = append(r.history, events...)
+	if len(r.history) > r.config.History {
+		r.history = r.history[len(r.history)-r.config.History:]
+	}
+}
+
+// RotationPolicyStatus is a policy with its last run on this instance and the earliest time one of its keys is due.
+type RotationPolicyStatus struct {
+	ConfigRotationPolicy
+	Next time.Time
+	Last time.Time
+}
+
+func (r *Rotator) Status() ([]RotationPolicyStatus, []RotationEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var policies []RotationPolicyStatus
+	for _, policy := range r.policies {
+		policies = append(policies, RotationPolicyStatus{ConfigRotationPolicy: policy.ConfigRotationPolicy, Last: r.last[policy.Name]})
+	}
+	history := slices.Clone(r.history)
+	slices.Reverse(history)
+	return policies, history
+}
+
+// rotationTarget is a key a policy rolls or generates, Skipped explains why it is left alone. Unseen keys have no
+// recorded change yet, their Next counts from now until a check records when it first saw them.
+type rotationTarget struct {
+	Namespace string
+	Key       string
+	Action    string
+	Skipped   string
+	Unseen    bool
+	Last      time.Time
+	Next      time.Time
+}
+
+func literalPattern(pattern string) bool {
+	return !strings.ContainsAny(pattern, `*?[\`)
+}
+
+// rotationTargets lists the keys matching the policy with their last and next rotation, files are skipped as rolling
+// would replace them with text. Missing keys that were never generated are due at once.
+func (App *Application) rotationTargets(logger *slog.Logger, policy *rotationPolicy, now time.Time) ([]rotationTarget, error) {
+	namespaces, err := App.KVDBClient.GetNamespaceList(logger)
+	if err != nil {
+		return nil, err
+	}
+	var targets []rotationTarget
+	for _, namespace := range namespaces {
+		if !matchPatterns(policy.Namespaces, namespace.Name) {
+			continue
+		}
+		kvlist, err := App.keyList(logger, namespace.Name)
+		if err != nil {
+			return targets, err
+		}
+		metadata, err := App.loadMetadata(logger, namespace.Name)
+		if err != nil {
+			return targets, err
+		}
+		first := len(targets)
+		existing := pairsToMap(kvlist)
+		for _, pair := range kvlist {
+			if !matchPatterns(policy.Keys, pair.Key) {
+				continue
+			}
+			target := rotationTarget{Namespace: namespace.Name, Key: pair.Key, Action: "Roll"}
+			if _, binary := parseBinaryValue(pair.Value); binary {
+				target.Skipped = "file value"
+			}
+			targets = append(targets, target)
+		}
+		for _, pattern := range policy.Keys {
+			if _, exists := existing[pattern]; literalPattern(pattern) && !exists && !App.protection(namespace.Name, pattern).Hidden {
+				targets = append(targets, rotationTarget{Namespace: namespace.Name, Key: pattern, Action: "Generate"})
+			}
+		}
+		for i := first; i < len(targets); i++ {
+			target := &targets[i]
+			target.Last = App.Rotator.lastRotation(namespace.Name, target.Key, metadata[target.Key])
+			switch {
+			case !target.Last.IsZero():
+				target.Next = App.Rotator.next(policy, namespace.Name, target.Key, target.Last)
+			case target.Action == "Roll":
+				target.Unseen = true
+				target.Next = App.Rotator.next(policy, namespace.Name, target.Key, now)
+			}
+		}
+	}
+	for i := range targets {
+		if targets[i].Skipped == "" && !App.keyWritable(targets[i].Namespace, targets[i].Key) {
+			targets[i].Skipped = "key is protected"
+		}
+	}
+	return targets, nil
+}
+
+// rotate rolls or generates the targets of the policy that are due, in dry-run mode it only records what would happen.
+// A key changed since it was listed, for example by another instance, is left for the next check. Unseen keys are
+// never rolled, the check records when it first saw them and they are due one period later.
+func (App *Application) rotate(logger *slog.Logger, policy *rotationPolicy, now time.Time) []RotationEvent {
+	targets, err := App.rotationTargets(logger, policy, now)
+	var events []RotationEvent
+	if err != nil {
+		logger.Error("Rotation failed listing keys", "policy", policy.Name, "error", err)
+		events = append(events, RotationEvent{Time: now, Policy: policy.Name, Outcome: "failure", Error: err.Error()})
+	}
+	App.recordSeen(logger, targets, now)
+	for _, target := range targets {
+		if target.Skipped != "" || target.Unseen || target.Next.After(now) {
+			continue
+		}
+		event := RotationEvent{Time: now, Policy: policy.Name, Namespace: target.Namespace, Key: target.Key, Action: target.Action, Outcome: "success"}
+		if App.Rotator.config.DryRun {
+			event.Outcome = "dry-run"
+		} else {
+			if metadata, err := App.loadMetadata(logger, target.Namespace); err == nil && metadata[target.Key].Updated.After(target.Last) {
+				continue
+			}
+			generator := policy.Generator
+			if generator == "" {
+				generator = App.Generators.Default(target.Namespace)
+			}
+			err := App.generateKey(logger, target.Namespace, target.Key, generator, target.Action == "Roll")
+			event.Outcome, event.Error = auditOutcome(err)
+			App.recordAudit(AuditEvent{Time: now, User: "rotation:" + policy.Name, Action: target.Action, Namespace: target.Namespace, Key: target.Key, Outcome: event.Outcome, Error: event.Error})
+		}
+		logger.Info("Rotation", "policy", policy.Name, "namespace", target.Namespace, "key", target.Key, "action", target.Action, "outcome", event.Outcome)
+		events = append(events, event)
+	}
+	for _, event := range events {
+		rotations.WithLabelValues(policy.Name, event.Outcome).Inc()
+	}
+	if next, ok := nextRotation(targets); ok {
+		rotationNext.WithLabelValues(policy.Name).Set(float64(next.Unix()))
+	}
+	return events
+}
+
+// recordSeen saves when unseen targets were first seen, in the metadata so restarts and other instances schedule them
+// from the same time and in memory in case the metadata could not be saved and in dry-run mode.
+func (App *Application) recordSeen(logger *slog.Logger, targets []rotationTarget, now time.Time) {
+	unseen := map[string][]string{}
+	for _, target := range targets {
+		if target.Unseen && target.Skipped == "" {
+			App.Rotator.see(target.Namespace, target.Key, now)
+			unseen[target.Namespace] = append(unseen[target.Namespace], target.Key)
+		}
+	}
+	if App.Rotator.config.DryRun {
+		return
+	}
+	for namespace, keys := range unseen {
+		err := App.updateMetadata(logger, namespace, func(metadata map[string]KeyMetadata) {
+			for _, key := range keys {
+				if entry := metadata[key]; entry.Updated.IsZero() && entry.Seen.IsZero() {
+					entry.Seen = now
+					metadata[key] = entry
+				}
+			}
+		})
+		if err != nil {
+			logger.Error("Rotation failed recording first seen keys", "namespace", namespace, "error", err)
+		}
+	}
+}
+
+// nextRotation returns the earliest time a target that is not skipped is due.
+func nextRotation(targets []rotationTarget) (time.Time, bool) {
+	var next time.Time
+	found := false
+	for _, target := range targets {
+		if target.Skipped == "" && (!found || target.Next.Before(next)) {
+			next, found = target.Next, true
+		}
+	}
+	return next, found
+}
+
+// runRotation rotates the keys of every policy that are due, overdue keys are rotated on the first check after a start.
+func (App *Application) runRotation(now time.Time) {
+	logger := App.Logger.With(slog.Any("function", "runRotation")).With(slog.Any("struct", "Application"))
+	for _, policy := range App.Rotator.policies {
+		App.Rotator.record(policy.Name, now, App.rotate(logger, policy, now))
+	}
+}
+
+// StartRotation checks for due keys at start and every CheckInterval in the background.
+func (App *Application) StartRotation() {
+	if len(App.Rotator.policies) == 0 {
+		return
+	}
+	if App.Config.ReadOnly {
+		App.Logger.Warn("Scheduled rotation is disabled in read-only mode")
+		return
+	}
+	App.Logger.Info(fmt.Sprintf("Scheduled rotation of %v policies, dry-run %v", len(App.Rotator.policies), App.Rotator.config.DryRun))
+	go func() {
+		App.runRotation(time.Now())
+		ticker := time.NewTicker(App.Rotator.config.CheckInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			App.runRotation(now)
+		}
+	}()
+}
+
+type RotationUpcoming struct {
+	rotationTarget
+	Policy string
+}
+
+type RotationStatus struct {
+	Page
+	DryRun   bool
+	Policies []RotationPolicyStatus
+	Upcoming []RotationUpcoming
+	History  []RotationEvent
+	Error    string
+}
+
+// RotationController shows the policies, the keys they will rotate next and past rotations.
+func (App *Application) RotationController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "RotationController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Rotation Request")
+	requests.WithLabelValues(request.Path, request.Method, "").Inc()
+	page := RotationStatus{Page: App.newPage(request), DryRun: App.Rotator.config.DryRun}
+	page.Api = "v1"
+	page.Policies, page.History = App.Rotator.Status()
+	for i, policy := range App.Rotator.policies {
+		targets, err := App.rotationTargets(logger, policy, time.Now())
+		if err != nil {
+			debugLogger.Debug("Rotation Targets Error", "type", fmt.Sprintf("%t", err), "error", err)
+			page.Error = fmt.Sprintf("Listing keys for %v failed: %v", policy.Name, err)
+		}
+		page.Policies[i].Next, _ = nextRotation(targets)
+		for _, target := range targets {
+			page.Upcoming = append(page.Upcoming, RotationUpcoming{rotationTarget: target, Policy: policy.Name})
+		}
+	}
+	slices.SortStableFunc(page.Upcoming, func(a, b RotationUpcoming) int { return a.Next.Compare(b.Next) })
+	logger.Info("Rotation request", "status", http.StatusOK)
+	App.renderPage(logger, w, http.StatusOK, "rotation.html", page)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRotatorSchedulesFromFirstSeen(t *testing.T) {
+	rotator, err := NewRotator(ConfigRotation{Jitter: time.Minute, Policies: []ConfigRotationPolicy{{Name: "db", Namespaces: []string{"app"}, Keys: []string{"db"}, Interval: time.Hour}}}, &Generators{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := rotator.policies[0]
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if last := rotator.lastRotation("app", "db", KeyMetadata{}); !last.IsZero() {
+		t.Fatalf("expected no last rotation, got %v", last)
+	}
+	rotator.see("app", "db", now)
+	rotator.see("app", "db", now.Add(time.Hour))
+	if last := rotator.lastRotation("app", "db", KeyMetadata{}); !last.Equal(now) {
+		t.Fatalf("expected first seen %v, got %v", now, last)
+	}
+	next := rotator.next(policy, "app", "db", now)
+	if next.Before(now.Add(time.Hour)) || !next.Before(now.Add(time.Hour+time.Minute)) {
+		t.Fatalf("expected next within the jitter after %v, got %v", now.Add(time.Hour), next)
+	}
+	updated := now.Add(2 * time.Hour)
+	if last := rotator.lastRotation("app", "db", KeyMetadata{Seen: now.Add(-time.Hour), Updated: updated}); !last.Equal(updated) {
+		t.Fatalf("expected updated time %v, got %v", updated, last)
+	}
+	if last := rotator.lastRotation("app", "other", KeyMetadata{Seen: now}); !last.Equal(now) {
+		t.Fatalf("expected seen time from metadata %v, got %v", now, last)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+const defaultContentSecurityPolicy = "default-src 'none'; script-src 'self' 'nonce-{nonce}'; style-src 'self' 'nonce-{nonce}'; img-src 'self' data:; connect-src 'self'; form-action 'self'; frame-ancestors 'none'; base-uri 'none'"
+
+type ConfigHeaders struct {
+	Enabled               bool   `mapstructure:"enabled"`
+	ContentSecurityPolicy string `mapstructure:"contentSecurityPolicy"`
+	FrameOptions          string `mapstructure:"frameOptions"`
+	ReferrerPolicy        string `mapstructure:"referrerPolicy"`
+	PermissionsPolicy     string `mapstructure:"permissionsPolicy"`
+	CacheControl          string `mapstructure:"cacheControl"`
+}
+
+type nonceContextKey struct{}
+
+// CSPNonce returns the Content-Security-Policy nonce generated for the request by SecurityHeaders.
+func CSPNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceContextKey{}).(string)
+	return nonce
+}
+
+func (App *Application) contentSecurityPolicy(nonce string) string {
+	policy := App.Config.Headers.ContentSecurityPolicy
+	if policy == "" {
+		policy = defaultContentSecurityPolicy
+		if App.Config.Web.CDN {
+			policy = strings.Replace(policy, "script-src 'self'", "script-src 'self' https://unpkg.com", 1)
+			policy = strings.Replace(policy, "style-src 'self'", "style-src 'self' https://cdn.jsdelivr.net", 1)
+		}
+	}
+	return strings.ReplaceAll(policy, "{nonce}", nonce)
+}
+
+// SecurityHeaders wraps a handler and sets the configured security headers on every response.
+// Responses outside /static/ are marked as not cacheable as they can contain secret values.
+func (App *Application) SecurityHeaders(next http.Handler) http.Handler {
+	if !App.Config.Headers.Enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := RandomToken(16)
+		header := w.Header()
+		header.Set("Content-Security-Policy", App.contentSecurityPolicy(nonce))
+		header.Set("X-Content-Type-Options", "nosniff")
+		if App.Config.Headers.FrameOptions != "" {
+			header.Set("X-Frame-Options", App.Config.Headers.FrameOptions)
+		}
+		if App.Config.Headers.ReferrerPolicy != "" {
+			header.Set("Referrer-Policy", App.Config.Headers.ReferrerPolicy)
+		}
+		if App.Config.Headers.PermissionsPolicy != "" {
+			header.Set("Permissions-Policy", App.Config.Headers.PermissionsPolicy)
+		}
+		if App.Config.Headers.CacheControl != "" && !strings.HasPrefix(r.URL.Path, staticPrefix) {
+			header.Set("Cache-Control", App.Config.Headers.CacheControl)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), nonceContextKey{}, nonce)))
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const sessionCookieName = "kvdbw_session"
+
+type ConfigSession struct {
+	Secret string        `mapstructure:"secret"`
+	MaxAge time.Duration `mapstructure:"maxAge"`
+}
+
+// Session is the login state kept in an encrypted cookie when the interface authenticates users itself.
+type Session struct {
+	User    string    `json:"user"`
+	Groups  []string  `json:"groups,omitempty"`
+	Expires time.Time `json:"expires"`
+}
+
+// SessionStore encrypts and authenticates cookie values with AES-GCM, the cookie name is bound as additional data.
+type SessionStore struct {
+	aead   cipher.AEAD
+	maxAge time.Duration
+}
+
+var ErrSessionInvalid = errors.New("session invalid")
+
+// NewSessionStore derives the key from secret, an empty secret generates a random key so sessions end on restart.
+func NewSessionStore(secret string, maxAge time.Duration) (*SessionStore, error) {
+	key := make([]byte, 32)
+	if secret == "" {
+		rand.Read(key)
+	} else {
+		sum := sha256.Sum256([]byte(secret))
+		key = sum[:]
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionStore{aead: aead, maxAge: maxAge}, nil
+}
+
+func (s *SessionStore) Seal(name string, value any) (string, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	rand.Read(nonce)
+	return base64.RawURLEncoding.EncodeToString(s.aead.Seal(nonce, nonce, plaintext, []byte(name))), nil
+}
+
+func (s *SessionStore) Open(name string, sealed string, value any) error {
+	ciphertext, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(ciphertext) < s.aead.NonceSize() {
+		return ErrSessionInvalid
+	}
+	plaintext, err := s.aead.Open(nil, ciphertext[:s.aead.NonceSize()], ciphertext[s.aead.NonceSize():], []byte(name))
+	if err != nil {
+		return ErrSessionInvalid
+	}
+	return json.Unmarshal(plaintext, value)
+}
+
+// sessionCookie returns a Lax cookie as login flows arrive through cross site redirects, state changes are guarded by CSRF tokens.
+func (App *Application) sessionCookie(name string, value string, maxAge time.Duration) *http.Cookie {
+	cookie := App.newCookie(name, value)
+	if cookie.SameSite == http.SameSiteStrictMode {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+	cookie.MaxAge = int(maxAge.Seconds())
+	return cookie
+}
+
+func (App *Application) clearCookie(w http.ResponseWriter, name string) {
+	cookie := App.newCookie(name, "")
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+}
+
+func (App *Application) startSession(w http.ResponseWriter, identity Identity) error {
+	session := Session{User: identity.User, Groups: identity.Groups, Expires: time.Now().Add(App.Sessions.maxAge)}
+	sealed, err := App.Sessions.Seal(sessionCookieName, session)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, App.sessionCookie(sessionCookieName, sealed, App.Sessions.maxAge))
+	return nil
+}
+
+// sessionIdentity returns the identity of a valid unexpired session cookie or an empty identity.
+func (App *Application) sessionIdentity(r *http.Request) Identity {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return Identity{}
+	}
+	var session Session
+	if App.Sessions.Open(sessionCookieName, cookie.Value, &session) != nil || time.Now().After(session.Expires) {
+		return Identity{}
+	}
+	return Identity{User: session.User, Groups: session.Groups}
+}
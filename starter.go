@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -22,10 +24,32 @@ var (
 )
 
 type ConfigType struct {
-	Logging    ConfigLogging    `mapstructure:"logging"`
-	Port       string           `mapstructure:"port"`
-	Backend    ConfigBackend    `mapstructure:"backend"`
-	Prometheus ConfigPrometheus `mapstructure:"prometheus"`
+	Logging       ConfigLogging          `mapstructure:"logging"`
+	Port          string                 `mapstructure:"port"`
+	Backend       ConfigBackend          `mapstructure:"backend"`
+	Prometheus    ConfigPrometheus       `mapstructure:"prometheus"`
+	Cookies       ConfigCookies          `mapstructure:"cookies"`
+	CSRF          ConfigCSRF             `mapstructure:"csrf"`
+	Web           ConfigWeb              `mapstructure:"web"`
+	Headers       ConfigHeaders          `mapstructure:"headers"`
+	Protection    []ConfigProtectionRule `mapstructure:"protection"`
+	Namespaces    ConfigNamespaces       `mapstructure:"namespaces"`
+	Formats       []ConfigFormatRule     `mapstructure:"formats"`
+	Values        ConfigValues           `mapstructure:"values"`
+	Generators    ConfigGenerators       `mapstructure:"generators"`
+	Report        ConfigReport           `mapstructure:"report"`
+	Rotation      ConfigRotation         `mapstructure:"rotation"`
+	Webhooks      ConfigWebhooks         `mapstructure:"webhooks"`
+	Metadata      ConfigMetadata         `mapstructure:"metadata"`
+	Expiry        ConfigExpiry           `mapstructure:"expiry"`
+	Trash         ConfigTrash            `mapstructure:"trash"`
+	Auth          ConfigAuth             `mapstructure:"auth"`
+	Audit         ConfigAudit            `mapstructure:"audit"`
+	Authorization ConfigAuthorization    `mapstructure:"authorization"`
+	Session       ConfigSession          `mapstructure:"session"`
+	OIDC          ConfigOIDC             `mapstructure:"oidc"`
+	Local         ConfigLocal            `mapstructure:"local"`
+	ReadOnly      bool                   `mapstructure:"readOnly"`
 }
 type ConfigLogging struct {
 	Level  string `mapstructure:"level"`
@@ -74,12 +98,98 @@ func ConfigRead(configFileName string, configOutput *ConfigType) {
 	configReader.SetDefault("backend.insecure", false)
 	configReader.SetDefault("prometheus.enabled", true)
 	configReader.SetDefault("prometheus.endpoint", "/system/metrics")
+	configReader.SetDefault("cookies.secure", true)
+	configReader.SetDefault("cookies.sameSite", "strict")
+	configReader.SetDefault("csrf.trustedOrigins", []string{})
+	configReader.SetDefault("web.overrideDirectory", "")
+	configReader.SetDefault("web.cdn", false)
+	configReader.SetDefault("protection", []map[string]any{
+		{"namespaces": []string{"kvdb"}, "mode": ProtectionNoDelete},
+		{"namespaces": []string{"kvdb"}, "keys": []string{"counter"}, "mode": ProtectionReadOnly},
+	})
+	configReader.SetDefault("auth.mode", "proxy")
+	configReader.SetDefault("auth.userHeader", "Remote-User")
+	configReader.SetDefault("auth.groupsHeader", "Remote-Groups")
+	configReader.SetDefault("auth.trustedProxies", []string{})
+	configReader.SetDefault("authorization.enabled", false)
+	configReader.SetDefault("readOnly", false)
+	configReader.SetDefault("formats", []map[string]any{})
+	configReader.SetDefault("values.maxFileSize", 16384)
+	configReader.SetDefault("values.fingerprintSecret", "")
+	configReader.SetDefault("generators.profiles", []map[string]any{
+		{"name": "strong", "type": "random", "length": 32, "classes": []string{"lower", "upper", "digits", "symbols"}, "excludeAmbiguous": true},
+		{"name": "alphanumeric", "type": "random", "length": 32, "classes": []string{"lower", "upper", "digits"}},
+		{"name": "passphrase", "type": "passphrase", "length": 6, "separator": "-"},
+		{"name": "uuid", "type": "uuid"},
+		{"name": "hex", "type": "hex", "length": 32},
+		{"name": "base64", "type": "base64", "length": 32},
+	})
+	configReader.SetDefault("generators.defaults", []map[string]any{})
+	configReader.SetDefault("report.minEntropy", 60)
+	configReader.SetDefault("report.minLength", 12)
+	configReader.SetDefault("rotation.dryRun", false)
+	configReader.SetDefault("rotation.jitter", "5m")
+	configReader.SetDefault("rotation.checkInterval", "1m")
+	configReader.SetDefault("rotation.history", 500)
+	configReader.SetDefault("rotation.policies", []map[string]any{})
+	configReader.SetDefault("webhooks.source", "/kvdbw")
+	configReader.SetDefault("webhooks.timeout", "10s")
+	configReader.SetDefault("webhooks.retries", 3)
+	configReader.SetDefault("webhooks.backoff", "2s")
+	configReader.SetDefault("webhooks.queue", 1000)
+	configReader.SetDefault("webhooks.history", 500)
+	configReader.SetDefault("webhooks.hooks", []map[string]any{})
+	configReader.SetDefault("metadata.namespace", "kvdbw-metadata")
+	configReader.SetDefault("expiry.warning", "336h")
+	configReader.SetDefault("expiry.refresh", "5m")
+	configReader.SetDefault("trash.namespace", "kvdbw-trash")
+	configReader.SetDefault("trash.retention", "720h")
+	configReader.SetDefault("trash.purgeInterval", "1h")
+	configReader.SetDefault("session.secret", "")
+	configReader.SetDefault("session.maxAge", "8h")
+	configReader.SetDefault("oidc.scopes", []string{"openid", "profile", "email", "groups"})
+	configReader.SetDefault("oidc.userClaim", "preferred_username")
+	configReader.SetDefault("oidc.groupsClaim", "groups")
+	configReader.SetDefault("local.usersFile", "users")
+	configReader.SetDefault("local.maxAttempts", 5)
+	configReader.SetDefault("local.lockout", "15m")
+	configReader.SetDefault("audit.file", "")
+	configReader.SetDefault("audit.stdout", true)
+	configReader.SetDefault("audit.memory", 1000)
+	configReader.SetDefault("headers.enabled", true)
+	configReader.SetDefault("headers.contentSecurityPolicy", "")
+	configReader.SetDefault("headers.frameOptions", "DENY")
+	configReader.SetDefault("headers.referrerPolicy", "same-origin")
+	configReader.SetDefault("headers.permissionsPolicy", "camera=(), microphone=(), geolocation=(), payment=(), usb=()")
+	configReader.SetDefault("headers.cacheControl", "no-store")
 	err := configReader.ReadInConfig() // Find and read the config file
 	if err != nil {                    // Handle errors reading the config file
 		panic(fmt.Errorf("fatal error config file: %w", err))
 	}
 	configReader.AutomaticEnv()
 	configReader.Unmarshal(configOutput)
+	if secret := os.Getenv(BaseENVname + "_SESSION_SECRET"); secret != "" {
+		configOutput.Session.Secret = secret
+	}
+	if secret := os.Getenv(BaseENVname + "_OIDC_CLIENT_SECRET"); secret != "" {
+		configOutput.OIDC.ClientSecret = secret
+	}
+	if secret := os.Getenv(BaseENVname + "_FINGERPRINT_SECRET"); secret != "" {
+		configOutput.Values.FingerprintSecret = secret
+	}
+	if undeletable := configOutput.Namespaces.Undeletable; len(undeletable) > 0 {
+		configOutput.Protection = append(configOutput.Protection, ConfigProtectionRule{Namespaces: undeletable, Mode: ProtectionNoDelete})
+	}
+	requirePositive("rotation.checkInterval", configOutput.Rotation.CheckInterval)
+	requirePositive("expiry.refresh", configOutput.Expiry.Refresh)
+	requirePositive("trash.purgeInterval", configOutput.Trash.PurgeInterval)
+}
+
+// requirePositive stops on intervals of background jobs that are zero or negative, time.NewTicker panics on them.
+func requirePositive(name string, value time.Duration) {
+	if value <= 0 {
+		panic(fmt.Errorf("fatal error config file: %v must be positive, got %v", name, value))
+	}
 }
 
 type Health struct {
@@ -92,15 +202,84 @@ func main() {
 	App := new(Application)
 	ConfigRead(configFileName, &App.Config)
 	App.setupLogging()
+	App.FingerprintKey = newFingerprintKey(App.Config.Values.FingerprintSecret)
+	if len(App.Config.Namespaces.Undeletable) > 0 {
+		App.Logger.Warn("namespaces.undeletable is deprecated, it is applied as a no-delete protection rule", "namespaces", App.Config.Namespaces.Undeletable)
+	}
+
+	assets, err := LoadAssets(App.Config.Web.OverrideDirectory)
+	if err != nil {
+		panic(fmt.Errorf("fatal error static files: %w", err))
+	}
+	App.Assets = assets
+	templates, err := LoadTemplates(App.Config.Web.OverrideDirectory, App.templateFuncs())
+	if err != nil {
+		panic(fmt.Errorf("fatal error templates: %w", err))
+	}
+	App.Templates = templates
+	if App.Config.Web.OverrideDirectory != "" {
+		App.Logger.Info(fmt.Sprintf("Serving templates and static files from %v", App.Config.Web.OverrideDirectory))
+	}
+
+	auditor, err := NewAuditor(App.Config.Audit, App.Logger)
+	if err != nil {
+		panic(fmt.Errorf("fatal error audit file: %w", err))
+	}
+	App.Auditor = auditor
+
+	sessions, err := NewSessionStore(App.Config.Session.Secret, App.Config.Session.MaxAge)
+	if err != nil {
+		panic(fmt.Errorf("fatal error session store: %w", err))
+	}
+	App.Sessions = sessions
+	if App.sessionAuth() && App.Config.Session.Secret == "" {
+		App.Logger.Warn("No session.secret configured, sessions will not survive a restart")
+	}
+	if App.Config.Authorization.Enabled && !App.sessionAuth() && len(App.Config.Auth.TrustedProxies) == 0 {
+		panic(fmt.Errorf("fatal error authorization: auth.trustedProxies must be set in proxy mode, otherwise anyone reaching the port can send %v and %v", App.Config.Auth.UserHeader, App.Config.Auth.GroupsHeader))
+	}
+	App.OIDC = NewOIDCClient(App.Config.OIDC)
+	generators, err := NewGenerators(App.Config.Generators)
+	if err != nil {
+		panic(fmt.Errorf("fatal error generators: %w", err))
+	}
+	App.Generators = generators
+	rotator, err := NewRotator(App.Config.Rotation, generators)
+	if err != nil {
+		panic(fmt.Errorf("fatal error rotation policies: %w", err))
+	}
+	App.Rotator = rotator
+	webhooks, err := NewWebhooks(App.Config.Webhooks, App.Logger)
+	if err != nil {
+		panic(fmt.Errorf("fatal error webhooks: %w", err))
+	}
+	App.Webhooks = webhooks
+	App.Metadata = NewMetadataStore(App.Config.Metadata)
+	App.Expiry = NewExpiryIndex()
+	App.Imports = NewImportStore()
+	if App.Config.Auth.Mode == "local" {
+		local, err := NewLocalAuth(App.Config.Local)
+		if err != nil {
+			panic(fmt.Errorf("fatal error users file: %w", err))
+		}
+		App.Local = local
+	}
 
 	httpClient := InitClient(App.Config.Backend)
+	httpClient.Changed = App.changed
 	App.KVDBClient = httpClient
+	App.Webhooks.Start()
+	App.StartExpiry()
+	App.StartTrashPurge()
+	App.StartRotation()
 	if App.Config.Prometheus.Enabled {
 		App.Logger.Info(fmt.Sprintf("Metrics enabled at %v", App.Config.Prometheus.Endpoint))
+		prometheus.MustRegister(App.Expiry)
 		http.Handle(App.Config.Prometheus.Endpoint, promhttp.Handler())
 	}
 	http.HandleFunc("/", http.HandlerFunc(App.RootController))
+	http.Handle(staticPrefix, App.Assets)
 	http.HandleFunc("/system/health", http.HandlerFunc(App.HealthActuator))
 	App.Logger.Info(fmt.Sprintf("Serving on port %v", App.Config.Port))
-	log.Fatal(http.ListenAndServe(":"+App.Config.Port, nil))
+	log.Fatal(http.ListenAndServe(":"+App.Config.Port, App.SecurityHeaders(http.DefaultServeMux)))
 }
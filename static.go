@@ -0,0 +1,95 @@
+package main
+
+//go:generate go run vendorassets.go
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+const staticPrefix = "/static/"
+
+// vendoredAssets are the third party files in static/vendor the templates depend on, see vendorassets.go.
+var vendoredAssets = []string{"vendor/bootstrap-5.3.2.min.css", "vendor/htmx-1.9.9.min.js"}
+
+type Assets struct {
+	files  fs.FS
+	reload bool
+	hashed map[string]string
+	lookup map[string]string
+}
+
+func StaticFiles(overrideDirectory string) fs.FS {
+	if overrideDirectory != "" {
+		return os.DirFS(path.Join(overrideDirectory, "static"))
+	}
+	files, _ := fs.Sub(embeddedStatic, "static")
+	return files
+}
+
+// LoadAssets indexes the static files and gives every file a name containing its content hash, so they can be cached forever.
+// When overrideDirectory is set files are read from disk and served under their plain names without long lived caching.
+// A missing vendored asset is an error, the pages would silently load without it.
+func LoadAssets(overrideDirectory string) (*Assets, error) {
+	assets := &Assets{files: StaticFiles(overrideDirectory), reload: overrideDirectory != "", hashed: make(map[string]string), lookup: make(map[string]string)}
+	for _, name := range vendoredAssets {
+		if _, err := fs.Stat(assets.files, name); err != nil {
+			return nil, fmt.Errorf("vendored asset %v is missing, restore it from git or run go generate: %w", name, err)
+		}
+	}
+	if assets.reload {
+		return assets, nil
+	}
+	err := fs.WalkDir(assets.files, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(assets.files, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		extension := path.Ext(name)
+		hashedName := strings.TrimSuffix(name, extension) + "." + hex.EncodeToString(sum[:6]) + extension
+		assets.hashed[name] = hashedName
+		assets.lookup[hashedName] = name
+		return nil
+	})
+	return assets, err
+}
+
+// Path returns the URL of a static file or an empty string when the file is not available.
+func (a *Assets) Path(name string) string {
+	if a.reload {
+		if _, err := fs.Stat(a.files, name); err != nil {
+			return ""
+		}
+		return staticPrefix + name
+	}
+	hashedName, ok := a.hashed[name]
+	if !ok {
+		return ""
+	}
+	return staticPrefix + hashedName
+}
+
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, staticPrefix)
+	if fileName, ok := a.lookup[name]; ok {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		http.ServeFileFS(w, r, a.files, fileName)
+		return
+	}
+	if _, err := fs.Stat(a.files, name); name == "" || err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFileFS(w, r, a.files, name)
+}
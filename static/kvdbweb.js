@@ -0,0 +1,17 @@
+// Ask for confirmation before submitting buttons marked with data-confirm
+document.addEventListener("click", function (event) {
+    var target = event.target.closest("[data-confirm]");
+    if (target && !window.confirm(target.dataset.confirm)) {
+        event.preventDefault();
+    }
+});
+
+// Toggle every checkbox named by data-select-all
+document.addEventListener("change", function (event) {
+    var name = event.target.dataset && event.target.dataset.selectAll;
+    if (name) {
+        document.querySelectorAll("input[type=checkbox][name='" + name + "']").forEach(function (checkbox) {
+            checkbox.checked = event.target.checked;
+        });
+    }
+});
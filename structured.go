@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	ValueFormatText = "text"
+	ValueFormatJSON = "json"
+	ValueFormatYAML = "yaml"
+)
+
+var valueFormats = []string{ValueFormatText, ValueFormatJSON, ValueFormatYAML}
+
+// ConfigFormatRule marks the keys matching Keys in namespaces matching Namespaces as JSON or YAML documents.
+type ConfigFormatRule struct {
+	Namespaces []string `mapstructure:"namespaces"`
+	Keys       []string `mapstructure:"keys"`
+	Format     string   `mapstructure:"format"`
+}
+
+// markedFormat returns the format of the first rule matching the key or an empty string.
+func (App *Application) markedFormat(namespace string, key string) string {
+	for _, rule := range App.Config.Formats {
+		if matchPatterns(rule.Namespaces, namespace) && matchPatterns(rule.Keys, key) {
+			return rule.Format
+		}
+	}
+	return ""
+}
+
+// detectValueFormat recognises JSON objects and arrays and YAML mappings and sequences, everything else is text.
+func detectValueFormat(value string) string {
+	trimmed := strings.TrimSpace(value)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if json.Valid([]byte(trimmed)) {
+			return ValueFormatJSON
+		}
+	}
+	if strings.Contains(trimmed, "\n") {
+		var document yaml.Node
+		if yaml.Unmarshal([]byte(trimmed), &document) == nil && len(document.Content) > 0 {
+			if kind := document.Content[0].Kind; kind == yaml.MappingNode || kind == yaml.SequenceNode {
+				return ValueFormatYAML
+			}
+		}
+	}
+	return ValueFormatText
+}
+
+func validateValue(format string, value string) error {
+	switch format {
+	case ValueFormatJSON:
+		var document any
+		return json.Unmarshal([]byte(value), &document)
+	case ValueFormatYAML:
+		var document yaml.Node
+		return yaml.Unmarshal([]byte(value), &document)
+	}
+	return nil
+}
+
+// prettyValue indents JSON with two spaces and rewrites YAML with two space indentation keeping comments.
+func prettyValue(format string, value string) (string, error) {
+	switch format {
+	case ValueFormatJSON:
+		var buffer bytes.Buffer
+		if err := json.Indent(&buffer, []byte(strings.TrimSpace(value)), "", "  "); err != nil {
+			return value, err
+		}
+		return buffer.String(), nil
+	case ValueFormatYAML:
+		var document yaml.Node
+		if err := yaml.Unmarshal([]byte(value), &document); err != nil {
+			return value, err
+		}
+		var buffer bytes.Buffer
+		encoder := yaml.NewEncoder(&buffer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&document); err != nil {
+			return value, err
+		}
+		encoder.Close()
+		return buffer.String(), nil
+	}
+	return value, nil
+}
+
+// validateKeyValue refuses values that are not valid documents for keys marked as JSON or YAML.
+func (App *Application) validateKeyValue(namespace string, key string, value string) error {
+	format := App.markedFormat(namespace, key)
+	if err := validateValue(format, value); err != nil {
+		return fmt.Errorf("value of %v is not valid %v: %w", key, strings.ToUpper(format), err)
+	}
+	return nil
+}
+
+type KeyEdit struct {
+	Page
+	Namespace string
+	Key       string
+	Value     string
+	Lines     int
+	Format    string
+	Marked    string
+	Formats   []string
+	ReadOnly  bool
+	Message   string
+	Error     string
+}
+
+// KeyEditController edits a single value with validation and pretty printing for JSON and YAML, nothing is saved until Save.
+func (App *Application) KeyEditController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "KeyEditController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Key Edit Request")
+	statuscode := http.StatusOK
+	key := request.orgRequest.URL.Query().Get("key")
+	kvlist, err := App.keyList(logger, request.Namespace)
+	if err != nil {
+		debugLogger.Debug("GetKeyList Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	value, exists := pairsToMap(kvlist)[key]
+	if !exists {
+		logger.Info("Key not found", "namespace", request.Namespace, "key", key, "status", http.StatusNotFound)
+		http.NotFound(w, request.orgRequest)
+		return
+	}
+	page := KeyEdit{Page: App.newPage(request), Namespace: request.Namespace, Key: key, Value: value, Marked: App.markedFormat(request.Namespace, key), Formats: valueFormats}
+	page.ReadOnly = !page.Role.CanEdit() || !App.keyWritable(request.Namespace, key)
+	page.Format = page.Marked
+	if page.Format == "" {
+		page.Format = detectValueFormat(value)
+	}
+	if request.Method == "POST" {
+		if !App.parsePost(logger, w, request) {
+			return
+		}
+		function := request.orgRequest.PostFormValue("input")
+		requests.WithLabelValues(request.Path, request.Method, function).Inc()
+		page.Value = request.orgRequest.PostFormValue("value")
+		if format := request.orgRequest.PostFormValue("format"); page.Marked == "" && slices.Contains(valueFormats, format) {
+			page.Format = format
+		}
+		switch function {
+		case "Validate":
+			if err := validateValue(page.Format, page.Value); err != nil {
+				statuscode, page.Error = http.StatusBadRequest, fmt.Sprintf("Not valid %v: %v", strings.ToUpper(page.Format), err)
+			} else {
+				page.Message = fmt.Sprintf("Valid %v", strings.ToUpper(page.Format))
+			}
+		case "Pretty print":
+			if page.Value, err = prettyValue(page.Format, page.Value); err != nil {
+				statuscode, page.Error = http.StatusBadRequest, fmt.Sprintf("Not valid %v: %v", strings.ToUpper(page.Format), err)
+			}
+		case "Save":
+			if !App.authorize(logger, w, request, request.Namespace, RoleEditor, "Update") {
+				return
+			}
+			if !App.keyWritable(request.Namespace, key) {
+				App.auditDenied(request, "Update", request.Namespace, key, "protected key")
+				App.ForbiddenHandler(logger, w, request)
+				return
+			}
+			if err = validateValue(page.Format, page.Value); err == nil {
+				err = App.KVDBClient.SetKey(logger, request.Namespace, key, page.Value)
+				App.audit(request, "Update", request.Namespace, key, err)
+				if err == nil {
+					logger.Info("Key saved", "namespace", request.Namespace, "key", key, "status", http.StatusSeeOther)
+					http.Redirect(w, request.orgRequest, "/"+request.Api+"/"+request.Namespace+"/", http.StatusSeeOther)
+					return
+				}
+				statuscode, page.Error = http.StatusBadGateway, fmt.Sprintf("Saving failed: %v", err)
+			} else {
+				statuscode, page.Error = http.StatusBadRequest, fmt.Sprintf("Not valid %v, nothing was saved: %v", strings.ToUpper(page.Format), err)
+				App.audit(request, "Update", request.Namespace, key, errors.New("invalid "+page.Format))
+			}
+		default:
+			debugLogger.Debug("Unknown post", "function", function)
+		}
+	} else {
+		requests.WithLabelValues(request.Path, request.Method, "").Inc()
+	}
+	page.Lines = min(max(App.countRune(page.Value, '\n'), 10), 40)
+	logger.Info("Key edit request", "status", statuscode)
+	App.renderPage(logger, w, statuscode, "keyedit.html", page)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+//go:embed static
+var embeddedStatic embed.FS
+
+const layoutTemplate = "layout.html"
+
+type ConfigWeb struct {
+	OverrideDirectory string `mapstructure:"overrideDirectory"`
+	CDN               bool   `mapstructure:"cdn"`
+}
+
+// Page holds the values used by the common layout, it is embedded in every page model.
+type Page struct {
+	Api         string
+	CSRFToken   string
+	Nonce       string
+	User        string
+	Role        Role
+	GlobalAdmin bool
+	CanCreate   bool
+	Logout      bool
+	ReadOnly    bool
+}
+
+type Templates struct {
+	files  fs.FS
+	reload bool
+	funcs  template.FuncMap
+	pages  map[string]*template.Template
+}
+
+// LoadTemplates parses every page in the templates directory together with the common layout and the shared partials.
+// When overrideDirectory is set templates are read from disk and parsed again on every render.
+func LoadTemplates(overrideDirectory string, funcs template.FuncMap) (*Templates, error) {
+	templates := &Templates{files: embeddedTemplates, funcs: funcs}
+	if overrideDirectory != "" {
+		templates.files = os.DirFS(overrideDirectory)
+		templates.reload = true
+	}
+	pages, err := templates.parse()
+	if err != nil {
+		return nil, err
+	}
+	templates.pages = pages
+	return templates, nil
+}
+
+func (t *Templates) parse() (map[string]*template.Template, error) {
+	names, err := fs.Glob(t.files, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	partials, err := fs.Glob(t.files, "templates/partials/*.html")
+	if err != nil {
+		return nil, err
+	}
+	pages := make(map[string]*template.Template)
+	for _, name := range names {
+		pageName := path.Base(name)
+		if pageName == layoutTemplate {
+			continue
+		}
+		// https://pkg.go.dev/html/template
+		patterns := []string{"templates/" + layoutTemplate, name}
+		if len(partials) > 0 {
+			patterns = append(patterns, "templates/partials/*.html")
+		}
+		page, err := template.New(pageName).Funcs(t.funcs).ParseFS(t.files, patterns...)
+		if err != nil {
+			return nil, err
+		}
+		pages[pageName] = page
+	}
+	return pages, nil
+}
+
+func (t *Templates) Render(buffer *bytes.Buffer, name string, data any) error {
+	pages := t.pages
+	if t.reload {
+		var err error
+		pages, err = t.parse()
+		if err != nil {
+			return err
+		}
+	}
+	page, ok := pages[name]
+	if !ok {
+		return fmt.Errorf("template %v not found", name)
+	}
+	return page.ExecuteTemplate(buffer, "layout", data)
+}
+
+// newPage fills the layout values, Role is the role on the requested namespace or the highest role held on any namespace.
+// GlobalAdmin and CanCreate use the same checks as authorizeGlobal and NamespaceCloneController.
+func (App *Application) newPage(request *RequestParameters) Page {
+	page := Page{Api: request.Api, CSRFToken: request.CSRFToken, Nonce: request.Nonce, User: request.Identity.User, Role: App.roleAny(request.Identity), GlobalAdmin: App.globalAdmin(request.Identity, true), CanCreate: App.canCreateNamespaces(request.Identity), Logout: App.sessionAuth(), ReadOnly: App.Config.ReadOnly}
+	if request.Namespace != "" {
+		page.Role = App.role(request.Identity, request.Namespace)
+	}
+	return page
+}
+
+func (App *Application) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"asset": App.Assets.Path,
+		"cdn":   func() bool { return App.Config.Web.CDN },
+	}
+}
+
+// renderPage renders the full page before writing so template errors can still produce a proper status code.
+func (App *Application) renderPage(logger *slog.Logger, w http.ResponseWriter, statuscode int, name string, data any) {
+	var buffer bytes.Buffer
+	err := App.Templates.Render(&buffer, name, data)
+	if err != nil {
+		logger.Error("Template Error", "template", name, "error", err)
+		App.InternalServerErrorHandler(logger, w)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(statuscode)
+	w.Write(buffer.Bytes())
+}
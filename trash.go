@@ -0,0 +1,355 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	TrashKindKey       = "key"
+	TrashKindNamespace = "namespace"
+)
+
+type ConfigTrash struct {
+	Namespace     string        `mapstructure:"namespace"`
+	Retention     time.Duration `mapstructure:"retention"`
+	PurgeInterval time.Duration `mapstructure:"purgeInterval"`
+}
+
+// TrashItem is a deleted key or namespace kept in the trash namespace until Expires, keyed by ID. A deleted namespace
+// is stored as one item per key and an item without a key, sharing Group, so no item is larger than its key. They are
+// listed as one item with the group as ID, documents holds the IDs of the stored items.
+type TrashItem struct {
+	ID        string                 `json:"id"`
+	Kind      string                 `json:"kind"`
+	Namespace string                 `json:"namespace"`
+	Group     string                 `json:"group,omitempty"`
+	Key       string                 `json:"key,omitempty"`
+	Value     string                 `json:"value,omitempty"`
+	Values    map[string]string      `json:"values,omitempty"`
+	Metadata  map[string]KeyMetadata `json:"metadata,omitempty"`
+	DeletedBy string                 `json:"deletedBy"`
+	Deleted   time.Time              `json:"deleted"`
+	Expires   time.Time              `json:"expires"`
+	documents []string
+}
+
+// ensureNamespace creates a reserved namespace the first time it is written to.
+func (App *Application) ensureNamespace(logger *slog.Logger, namespace string) error {
+	exists, err := App.namespaceExists(logger, namespace)
+	if err != nil || exists {
+		return err
+	}
+	return App.KVDBClient.CreateNamespace(logger, namespace)
+}
+
+// putTrash stores the item under a new ID, items of a group share the deletion time set by the caller.
+func (App *Application) putTrash(logger *slog.Logger, item TrashItem) (string, error) {
+	item.ID = RandomToken(8)
+	if item.Deleted.IsZero() {
+		item.Deleted = time.Now().UTC()
+		item.Expires = item.Deleted.Add(App.Config.Trash.Retention)
+	}
+	document, err := json.Marshal(item)
+	if err != nil {
+		return "", err
+	}
+	if err := App.ensureNamespace(logger, App.Config.Trash.Namespace); err != nil {
+		return "", err
+	}
+	return item.ID, App.KVDBClient.SetKey(logger, App.Config.Trash.Namespace, item.ID, string(document))
+}
+
+// removeTrash deletes the stored items of a listed item.
+func (App *Application) removeTrash(logger *slog.Logger, item TrashItem) error {
+	for _, id := range item.documents {
+		if err := App.KVDBClient.DeleteKey(logger, App.Config.Trash.Namespace, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteKey moves the key into the trash before deleting it, nothing is deleted when the trash can not be written.
+// A missing key returns the backend's 404 without touching the trash.
+func (App *Application) deleteKey(logger *slog.Logger, user string, namespace string, key string) error {
+	pair, err := App.KVDBClient.GetKey(logger, namespace, key)
+	if err != nil {
+		return err
+	}
+	item := TrashItem{Kind: TrashKindKey, Namespace: namespace, Key: key, Value: pair.Value, DeletedBy: user}
+	if metadata, err := App.loadMetadata(logger, namespace); err == nil {
+		if entry, exists := metadata[key]; exists {
+			item.Metadata = map[string]KeyMetadata{key: entry}
+		}
+	}
+	if _, err := App.putTrash(logger, item); err != nil {
+		return fmt.Errorf("moving %v to the trash failed: %w", key, err)
+	}
+	return App.KVDBClient.DeleteKey(logger, namespace, key)
+}
+
+// deleteNamespace moves all keys of the namespace into the trash before deleting it, one item per key. Items already
+// written are removed again and nothing is deleted when the trash can not be written.
+func (App *Application) deleteNamespace(logger *slog.Logger, user string, namespace string) error {
+	kvlist, err := App.KVDBClient.GetKeyList(logger, namespace)
+	if err != nil {
+		return err
+	}
+	// keys are trashed without metadata when it can not be read, as for single keys
+	metadata, _ := App.loadMetadata(logger, namespace)
+	now := time.Now().UTC()
+	group := TrashItem{Kind: TrashKindNamespace, Namespace: namespace, Group: RandomToken(8), DeletedBy: user, Deleted: now, Expires: now.Add(App.Config.Trash.Retention)}
+	items := []TrashItem{group}
+	for _, pair := range kvlist {
+		item := group
+		item.Key, item.Value = pair.Key, pair.Value
+		if entry, exists := metadata[pair.Key]; exists {
+			item.Metadata = map[string]KeyMetadata{pair.Key: entry}
+		}
+		items = append(items, item)
+	}
+	for _, item := range items {
+		id, err := App.putTrash(logger, item)
+		if err != nil {
+			if err := App.removeTrash(logger, group); err != nil {
+				logger.Error("Trash cleanup failed", "namespace", namespace, "error", err)
+			}
+			return fmt.Errorf("moving %v to the trash failed: %w", namespace, err)
+		}
+		group.documents = append(group.documents, id)
+	}
+	return App.KVDBClient.DeleteNamespace(logger, namespace)
+}
+
+// trashItems returns all items in the trash, newest first.
+func (App *Application) trashItems(logger *slog.Logger) ([]TrashItem, error) {
+	list, err := App.KVDBClient.GetKeyList(logger, App.Config.Trash.Namespace)
+	var statusError *HTTPStatusError
+	if errors.As(err, &statusError) && statusError.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []TrashItem
+	groups := map[string]int{}
+	for _, pair := range list {
+		var item TrashItem
+		if err := json.Unmarshal([]byte(pair.Value), &item); err != nil {
+			logger.Warn("Trash item is not valid", "id", pair.Key, "error", err)
+			continue
+		}
+		item.ID, item.documents = pair.Key, []string{pair.Key}
+		if item.Group == "" {
+			items = append(items, item)
+			continue
+		}
+		index, exists := groups[item.Group]
+		if !exists {
+			index = len(items)
+			groups[item.Group] = index
+			items = append(items, TrashItem{ID: item.Group, Kind: item.Kind, Namespace: item.Namespace, Group: item.Group, Values: map[string]string{}, Metadata: map[string]KeyMetadata{}, DeletedBy: item.DeletedBy, Deleted: item.Deleted, Expires: item.Expires})
+		}
+		group := &items[index]
+		group.documents = append(group.documents, pair.Key)
+		if item.Key != "" {
+			group.Values[item.Key] = item.Value
+		}
+		for key, entry := range item.Metadata {
+			group.Metadata[key] = entry
+		}
+	}
+	slices.SortFunc(items, func(a, b TrashItem) int { return b.Deleted.Compare(a.Deleted) })
+	return items, nil
+}
+
+// protectedTrashKeys lists the keys of the item the protection rules do not allow the interface to write.
+func (App *Application) protectedTrashKeys(item TrashItem) []string {
+	var protected []string
+	if item.Kind == TrashKindKey && !App.keyWritable(item.Namespace, item.Key) {
+		protected = append(protected, item.Key)
+	}
+	for key := range item.Values {
+		if !App.keyWritable(item.Namespace, key) {
+			protected = append(protected, key)
+		}
+	}
+	slices.Sort(protected)
+	return protected
+}
+
+// restoreTrash writes the item back and removes it from the trash, existing keys and namespaces are not overwritten.
+func (App *Application) restoreTrash(logger *slog.Logger, item TrashItem) error {
+	kvlist, err := App.KVDBClient.GetKeyList(logger, item.Namespace)
+	var statusError *HTTPStatusError
+	missing := errors.As(err, &statusError) && statusError.StatusCode == http.StatusNotFound
+	if err != nil && !missing {
+		return err
+	}
+	switch item.Kind {
+	case TrashKindKey:
+		if _, exists := pairsToMap(kvlist)[item.Key]; exists {
+			return fmt.Errorf("key %v already exists in %v", item.Key, item.Namespace)
+		}
+		if missing {
+			return fmt.Errorf("namespace %v does not exist", item.Namespace)
+		}
+		if err := App.KVDBClient.SetKey(logger, item.Namespace, item.Key, item.Value); err != nil {
+			return err
+		}
+	case TrashKindNamespace:
+		if !missing {
+			return fmt.Errorf("namespace %v already exists", item.Namespace)
+		}
+		if err := App.KVDBClient.CreateNamespace(logger, item.Namespace); err != nil {
+			return err
+		}
+		App.batchMetadata(logger, item.Namespace, func() {
+			for key, value := range item.Values {
+				if err = App.KVDBClient.SetKey(logger, item.Namespace, key, value); err != nil {
+					return
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(item.Metadata) > 0 {
+		err := App.updateMetadata(logger, item.Namespace, func(metadata map[string]KeyMetadata) {
+			for key, entry := range item.Metadata {
+				entry.Updated = metadata[key].Updated
+				metadata[key] = entry
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return App.removeTrash(logger, item)
+}
+
+// purgeTrash removes items past their retention.
+func (App *Application) purgeTrash(logger *slog.Logger, now time.Time) {
+	items, err := App.trashItems(logger)
+	if err != nil {
+		logger.Error("Trash purge failed", "error", err)
+		return
+	}
+	for _, item := range items {
+		if item.Expires.After(now) {
+			continue
+		}
+		err := App.removeTrash(logger, item)
+		event := AuditEvent{Time: now.UTC(), User: "trash", Action: "Purge", Namespace: item.Namespace, Key: item.Key}
+		event.Outcome, event.Error = auditOutcome(err)
+		App.recordAudit(event)
+		if err != nil {
+			logger.Error("Trash purge failed", "id", item.ID, "error", err)
+		}
+	}
+}
+
+// StartTrashPurge removes expired trash items every trash.purgeInterval in the background.
+func (App *Application) StartTrashPurge() {
+	if App.Config.ReadOnly {
+		return
+	}
+	logger := App.Logger.With(slog.Any("function", "StartTrashPurge")).With(slog.Any("struct", "Application"))
+	go func() {
+		ticker := time.NewTicker(App.Config.Trash.PurgeInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			App.purgeTrash(logger, now)
+		}
+	}()
+}
+
+type TrashEntry struct {
+	TrashItem
+	Keys       int
+	CanRestore bool
+	CanPurge   bool
+}
+
+type TrashList struct {
+	Page
+	Items   []TrashEntry
+	Results []KeyResult
+}
+
+// TrashController lists deleted keys and namespaces the user can view and restores or purges them.
+func (App *Application) TrashController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "TrashController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Trash Request")
+	statuscode := http.StatusOK
+	page := TrashList{Page: App.newPage(request)}
+	page.Api = "v1"
+	items, err := App.trashItems(logger)
+	if err != nil {
+		debugLogger.Debug("Trash Error", "type", fmt.Sprintf("%t", err), "error", err)
+		App.BadRequestHandler(logger, w, request)
+		return
+	}
+	if request.Method == "POST" {
+		if !App.parsePost(logger, w, request) {
+			return
+		}
+		function := request.orgRequest.PostFormValue("input")
+		requests.WithLabelValues(request.Path, request.Method, function).Inc()
+		id := request.orgRequest.PostFormValue("id")
+		index := slices.IndexFunc(items, func(item TrashItem) bool { return item.ID == id })
+		if index < 0 || function != "Restore" && function != "Purge" {
+			debugLogger.Debug("Unknown post", "function", function, "id", id)
+			App.BadRequestHandler(logger, w, request)
+			return
+		}
+		item := items[index]
+		required := RoleAdmin
+		if item.Kind == TrashKindKey && function == "Restore" {
+			required = RoleEditor
+		}
+		if !App.authorize(logger, w, request, item.Namespace, required, function) {
+			return
+		}
+		if protected := App.protectedTrashKeys(item); function == "Restore" && len(protected) > 0 {
+			logger.Info("Protected key", "namespace", item.Namespace, "keys", protected)
+			App.auditDenied(request, function, item.Namespace, item.Key, "protected key")
+			App.ForbiddenHandler(logger, w, request)
+			return
+		}
+		result := KeyResult{Key: item.Namespace + "/" + item.Key, Result: function + "d"}
+		if function == "Restore" {
+			err = App.restoreTrash(logger, item)
+		} else {
+			err = App.removeTrash(logger, item)
+		}
+		App.audit(request, function, item.Namespace, item.Key, err)
+		if err != nil {
+			statuscode = http.StatusConflict
+			result.Result, result.Error = "Failed", err.Error()
+		} else {
+			items = slices.Delete(items, index, index+1)
+		}
+		page.Results = []KeyResult{result}
+	} else {
+		requests.WithLabelValues(request.Path, request.Method, "").Inc()
+	}
+	for _, item := range items {
+		role := App.role(request.Identity, item.Namespace)
+		if !role.CanView() {
+			continue
+		}
+		canRestore := (role.CanAdmin() || item.Kind == TrashKindKey && role.CanEdit()) && len(App.protectedTrashKeys(item)) == 0
+		page.Items = append(page.Items, TrashEntry{TrashItem: item, Keys: len(item.Values), CanRestore: canRestore, CanPurge: role.CanAdmin()})
+	}
+	logger.Info("Trash request", "status", statuscode)
+	App.renderPage(logger, w, statuscode, "trash.html", page)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"unicode/utf8"
+)
+
+// newFingerprintKey returns the key of the value fingerprints so weak values can not be found by hashing guesses, it
+// is random per start unless a secret is set, fingerprints from different runs can then not be compared.
+func newFingerprintKey(secret string) []byte {
+	if secret == "" {
+		key := make([]byte, 32)
+		rand.Read(key)
+		return key
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// ValueFingerprint identifies a value without revealing it, equal values share a fingerprint.
+func ValueFingerprint(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:6])
+}
+
+// MaskValue describes a value by length and fingerprint so changes can be shown without the clear text.
+func MaskValue(key []byte, value string) string {
+	if value == "" {
+		return "(empty)"
+	}
+	return fmt.Sprintf("•••• %v chars %v", utf8.RuneCountInString(value), ValueFingerprint(key, value))
+}
@@ -0,0 +1,73 @@
+//go:build ignore
+
+// Downloads the third party assets served from static/vendor and verifies them against their subresource integrity hash.
+// Run with go generate, files already present with the correct hash are left untouched. The files are committed, with
+// -check nothing is downloaded and missing or changed files fail, so builds without internet access can verify them. With
+// -missing committed files must match and only files that are not committed are downloaded.
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+)
+
+type vendorAsset struct {
+	File      string
+	URL       string
+	Integrity string
+}
+
+var vendorAssets = []vendorAsset{
+	// https://getbootstrap.com/
+	{File: "static/vendor/bootstrap-5.3.2.min.css", URL: "https://cdn.jsdelivr.net/npm/bootstrap@5.3.2/dist/css/bootstrap.min.css", Integrity: "sha384-T3c6CoIi6uLrA9TneNEoa7RxnatzjcDSCmG1MXxSR1GAsXEV/Dwwykc2MPK8M2HN"},
+	// https://htmx.org/docs/#download-a-copy
+	{File: "static/vendor/htmx-1.9.9.min.js", URL: "https://unpkg.com/htmx.org@1.9.9/dist/htmx.min.js", Integrity: "sha384-QFjmbokDn2DjBjq+fM+8LUIVrAgqcNW2s0PjAxHETgRn9l4fvX31ZxDxvwQnyMOX"},
+}
+
+func integrity(content []byte) string {
+	sum := sha512.Sum384(content)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func main() {
+	check := flag.Bool("check", false, "Only verify the committed files, nothing is downloaded")
+	missing := flag.Bool("missing", false, "Verify the committed files and only download the files that are not committed")
+	flag.Parse()
+	for _, asset := range vendorAssets {
+		content, err := os.ReadFile(asset.File)
+		if err == nil && integrity(content) == asset.Integrity {
+			log.Printf("I %v up to date", asset.File)
+			continue
+		}
+		if *check || (*missing && err == nil) {
+			if err != nil {
+				log.Fatalf("E %v: %v", asset.File, err)
+			}
+			log.Fatalf("E %v: integrity mismatch got %v", asset.File, integrity(content))
+		}
+		resp, err := http.Get(asset.URL)
+		if err != nil {
+			log.Fatalf("E %v: %v", asset.URL, err)
+		}
+		content, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			log.Fatalf("E %v: %v %v", asset.URL, resp.Status, err)
+		}
+		if integrity(content) != asset.Integrity {
+			log.Fatalf("E %v: integrity mismatch got %v", asset.URL, integrity(content))
+		}
+		os.MkdirAll(path.Dir(asset.File), 0755)
+		if err := os.WriteFile(asset.File, content, 0644); err != nil {
+			log.Fatalf("E %v: %v", asset.File, err)
+		}
+		fmt.Printf("I %v downloaded\n", asset.File)
+	}
+}
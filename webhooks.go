@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var webhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "kvdbw_webhook_deliveries_count",
+	Help: "The amount of webhook deliveries by hook and outcome",
+}, []string{"hook", "outcome"},
+)
+
+// webhookEventTypes maps backend operations to the event names used in filters and the CloudEvents type.
+var webhookEventTypes = map[string]string{
+	"SetKey":          "key.set",
+	"Roll":            "key.rolled",
+	"Generate":        "key.generated",
+	"DeleteKey":       "key.deleted",
+	"CreateNamespace": "namespace.created",
+	"DeleteNamespace": "namespace.deleted",
+}
+
+const webhookTypePrefix = "io.github.simonstiil.kvdbw."
+
+type ConfigWebhooks struct {
+	Source  string          `mapstructure:"source"`
+	Timeout time.Duration   `mapstructure:"timeout"`
+	Retries int             `mapstructure:"retries"`
+	Backoff time.Duration   `mapstructure:"backoff"`
+	Queue   int             `mapstructure:"queue"`
+	History int             `mapstructure:"history"`
+	Hooks   []ConfigWebhook `mapstructure:"hooks"`
+}
+
+// ConfigWebhook posts the events in Events for namespaces matching Namespaces and keys matching Keys to URL,
+// empty lists match everything. Secret may also be set as KVDBW_WEBHOOK_<NAME>_SECRET.
+type ConfigWebhook struct {
+	Name       string   `mapstructure:"name"`
+	URL        string   `mapstructure:"url"`
+	Secret     string   `mapstructure:"secret"`
+	Namespaces []string `mapstructure:"namespaces"`
+	Keys       []string `mapstructure:"keys"`
+	Events     []string `mapstructure:"events"`
+}
+
+// CloudEvent is a CloudEvents 1.0 event in structured JSON mode, Data never contains values.
+type CloudEvent struct {
+	SpecVersion     string           `json:"specversion"`
+	ID              string           `json:"id"`
+	Source          string           `json:"source"`
+	Type            string           `json:"type"`
+	Subject         string           `json:"subject"`
+	Time            time.Time        `json:"time"`
+	DataContentType string           `json:"datacontenttype"`
+	Data            CloudEventChange `json:"data"`
+}
+
+type CloudEventChange struct {
+	Namespace string `json:"namespace"`
+	Key       string `json:"key,omitempty"`
+	Action    string `json:"action"`
+}
+
+// WebhookDelivery is the outcome of delivering one event to one hook.
+type WebhookDelivery struct {
+	Time     time.Time
+	Hook     string
+	EventID  string
+	Type     string
+	Subject  string
+	Attempts int
+	Status   int
+	Outcome  string
+	Error    string
+}
+
+type webhookJob struct {
+	hook  ConfigWebhook
+	event CloudEvent
+}
+
+// Webhooks keeps a queue per hook, so a slow or failing receiver only delays its own events.
+type Webhooks struct {
+	config  ConfigWebhooks
+	client  *http.Client
+	queues  map[string]chan webhookJob
+	mutex   sync.Mutex
+	history []WebhookDelivery
+	logger  *slog.Logger
+}
+
+// NewWebhooks checks the hooks and reads their secrets, deliveries start with Start.
+func NewWebhooks(config ConfigWebhooks, logger *slog.Logger) (*Webhooks, error) {
+	queues := map[string]chan webhookJob{}
+	for i, hook := range config.Hooks {
+		if hook.Name == "" || hook.URL == "" {
+			return nil, fmt.Errorf("webhook %v needs a name and url", i)
+		}
+		if _, exists := queues[hook.Name]; exists {
+			return nil, fmt.Errorf("webhook %v: name is used more than once", hook.Name)
+		}
+		queues[hook.Name] = make(chan webhookJob, config.Queue)
+		if !strings.HasPrefix(hook.URL, "http://") && !strings.HasPrefix(hook.URL, "https://") {
+			return nil, fmt.Errorf("webhook %v: url must be http or https", hook.Name)
+		}
+		for _, event := range hook.Events {
+			if !slices.Contains(slices.Collect(maps.Values(webhookEventTypes)), event) {
+				return nil, fmt.Errorf("webhook %v: unknown event %q", hook.Name, event)
+			}
+		}
+		if secret := os.Getenv(BaseENVname + "_WEBHOOK_" + strings.ToUpper(strings.ReplaceAll(hook.Name, "-", "_")) + "_SECRET"); secret != "" {
+			config.Hooks[i].Secret = secret
+		}
+	}
+	return &Webhooks{config: config, client: &http.Client{Timeout: config.Timeout}, queues: queues, logger: logger}, nil
+}
+
+func (hook ConfigWebhook) matches(event string, namespace string, key string) bool {
+	if len(hook.Events) > 0 && !slices.Contains(hook.Events, event) {
+		return false
+	}
+	if len(hook.Namespaces) > 0 && !matchPatterns(hook.Namespaces, namespace) {
+		return false
+	}
+	return key == "" || len(hook.Keys) == 0 || matchPatterns(hook.Keys, key)
+}
+
+// Notify queues an event for every matching hook, it is used as the backend client's Changed callback.
+func (wh *Webhooks) Notify(action string, namespace string, key string) {
+	name, ok := webhookEventTypes[action]
+	if !ok {
+		return
+	}
+	subject := namespace
+	if key != "" {
+		subject += "/" + key
+	}
+	event := CloudEvent{SpecVersion: "1.0", ID: RandomToken(16), Source: wh.config.Source, Type: webhookTypePrefix + name, Subject: subject, Time: time.Now().UTC(), DataContentType: "application/json", Data: CloudEventChange{Namespace: namespace, Key: key, Action: action}}
+	for _, hook := range wh.config.Hooks {
+		if !hook.matches(name, namespace, key) {
+			continue
+		}
+		select {
+		case wh.queues[hook.Name] <- webhookJob{hook: hook, event: event}:
+		default:
+			wh.record(WebhookDelivery{Time: event.Time, Hook: hook.Name, EventID: event.ID, Type: event.Type, Subject: subject, Outcome: "dropped", Error: "delivery queue is full"})
+		}
+	}
+}
+
+// Start delivers the queued events of each hook in order in a background worker per hook.
+func (wh *Webhooks) Start() {
+	if len(wh.config.Hooks) == 0 {
+		return
+	}
+	wh.logger.Info(fmt.Sprintf("Webhooks enabled for %v hooks", len(wh.config.Hooks)))
+	for _, queue := range wh.queues {
+		go func() {
+			for job := range queue {
+				wh.record(wh.deliver(job))
+			}
+		}()
+	}
+}
+
+// sign returns the hex HMAC-SHA256 of the body with the hook's secret.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver posts the event and retries failures with a doubling backoff, a 2xx answer is a success.
+func (wh *Webhooks) deliver(job webhookJob) WebhookDelivery {
+	delivery := WebhookDelivery{Time: job.event.Time, Hook: job.hook.Name, EventID: job.event.ID, Type: job.event.Type, Subject: job.event.Subject}
+	body, err := json.Marshal(job.event)
+	if err != nil {
+		delivery.Outcome, delivery.Error = "failure", err.Error()
+		return delivery
+	}
+	backoff := wh.config.Backoff
+	for delivery.Attempts = 1; ; delivery.Attempts++ {
+		delivery.Status, err = wh.post(job.hook, body)
+		if err == nil {
+			delivery.Outcome, delivery.Error = "success", ""
+			break
+		}
+		delivery.Outcome, delivery.Error = "failure", err.Error()
+		wh.logger.Debug("Webhook delivery failed", "hook", job.hook.Name, "event", job.event.ID, "attempt", delivery.Attempts, "error", err)
+		if delivery.Attempts > wh.config.Retries {
+			break
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	wh.logger.Info("Webhook delivery", "hook", job.hook.Name, "type", job.event.Type, "subject", job.event.Subject, "attempts", delivery.Attempts, "outcome", delivery.Outcome)
+	return delivery
+}
+
+func (wh *Webhooks) post(hook ConfigWebhook, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json")
+	if hook.Secret != "" {
+		req.Header.Set("X-Kvdbw-Signature", "sha256="+sign(hook.Secret, body))
+	}
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return resp.StatusCode, nil
+}
+
+func (wh *Webhooks) record(delivery WebhookDelivery) {
+	webhookDeliveries.WithLabelValues(delivery.Hook, delivery.Outcome).Inc()
+	wh.mutex.Lock()
+	defer wh.mutex.Unlock()
+	wh.history = append(wh.history, delivery)
+	if len(wh.history) > wh.config.History {
+		wh.history = wh.history[len(wh.history)-wh.config.History:]
+	}
+}
+
+// Deliveries returns the delivery log newest first.
+func (wh *Webhooks) Deliveries() []WebhookDelivery {
+	wh.mutex.Lock()
+	defer wh.mutex.Unlock()
+	deliveries := slices.Clone(wh.history)
+	slices.Reverse(deliveries)
+	return deliveries
+}
+
+type WebhookLog struct {
+	Page
+	Hooks      []ConfigWebhook
+	Deliveries []WebhookDelivery
+}
+
+// WebhooksController shows the configured hooks and the delivery log.
+func (App *Application) WebhooksController(w http.ResponseWriter, request *RequestParameters) {
+	logger := App.Logger.With(slog.Any("id", request.ID)).With(slog.Any("remoteAddr", request.orgRequest.RemoteAddr)).With(slog.Any("method", request.Method), "path", request.Path)
+	debugLogger := logger.With(slog.Any("function", "WebhooksController")).With(slog.Any("struct", "Application"))
+	debugLogger.Debug("Webhooks Request")
+	requests.WithLabelValues(request.Path, request.Method, "").Inc()
+	page := WebhookLog{Page: App.newPage(request), Hooks: App.Webhooks.config.Hooks, Deliveries: App.Webhooks.Deliveries()}
+	page.Api = "v1"
+	logger.Info("Webhooks request", "status", http.StatusOK)
+	App.renderPage(logger, w, http.StatusOK, "webhooks.html", page)
+}